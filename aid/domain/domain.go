@@ -0,0 +1,56 @@
+// Package domain 基于内置的公共后缀列表(Public Suffix List)计算可注册域名，
+// 供代理分组、抓取范围过滤与按站点统计等逻辑统一使用。
+package domain
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Registrable 返回host的可注册域名（eTLD+1），如 www.example.co.uk 返回 example.co.uk；
+// IP地址、单标签主机名及本身即为公共后缀的host原样返回（小写、去端口）
+func Registrable(host string) string {
+	host = Hostname(host)
+	if host == "" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return host
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return d
+}
+
+// FromURL 返回链接的可注册域名，无法解析时返回空
+func FromURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return Registrable(u.Host)
+}
+
+// SameSite 判断两个host或链接是否属于同一可注册域名
+func SameSite(a, b string) bool {
+	da, db := key(a), key(b)
+	return da != "" && da == db
+}
+
+// Hostname 去除端口与末尾的点并转为小写
+func Hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func key(s string) string {
+	if strings.Contains(s, "://") {
+		return FromURL(s)
+	}
+	return Registrable(s)
+}
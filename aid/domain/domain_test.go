@@ -0,0 +1,32 @@
+package domain
+
+import "testing"
+
+func TestRegistrable(t *testing.T) {
+	cases := map[string]string{
+		"www.example.com":      "example.com",
+		"example.com":          "example.com",
+		"a.b.example.com:8080": "example.com",
+		"a.co.uk":              "a.co.uk",
+		"www.b.co.uk":          "b.co.uk",
+		"co.uk":                "co.uk",
+		"WWW.Example.COM.":     "example.com",
+		"127.0.0.1:80":         "127.0.0.1",
+		"[::1]:80":             "::1",
+		"localhost":            "localhost",
+	}
+	for host, want := range cases {
+		if got := Registrable(host); got != want {
+			t.Errorf("Registrable(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	if !SameSite("http://www.example.com/a", "example.com") {
+		t.Error("www.example.com and example.com should be the same site")
+	}
+	if SameSite("a.co.uk", "b.co.uk") {
+		t.Error("a.co.uk and b.co.uk should not be the same site")
+	}
+}
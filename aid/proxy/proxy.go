@@ -1,232 +1,471 @@
 package proxy
 
 import (
-	"io/ioutil"
+	"bytes"
+	"errors"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
-	"net/url"
-	"os"
 	"regexp"
-	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"go-spider/aid/domain"
 	"go-spider/downloader/request"
 	"go-spider/downloader/surfer"
-	"go-spider/common/ping"
 	"go-spider/config"
 	"go-spider/logs"
 )
 
 type Proxy struct {
-	ipRegexp           *regexp.Regexp
-	proxyIPTypeRegexp  *regexp.Regexp
-	proxyUrlTypeRegexp *regexp.Regexp
-	allIps             map[string]string
+	sources            []ProxySource
+	bySource           map[string]map[string]bool
 	all                map[string]bool
+	sessions           map[string]string
+	scores             map[string]*Score
+	checkUrl           string
 	online             int32
-	usable             map[string]*ProxyForHost
 	ticker             *time.Ticker
 	tickMinute         int64
+	checking           int32
 	threadPool         chan bool
 	surf               surfer.Surfer
 	sync.Mutex
 }
 
 const (
-	CONN_TIMEOUT = 4 
-	DAIL_TIMEOUT = 4 
+	CONN_TIMEOUT = 4
+	DAIL_TIMEOUT = 4
 	TRY_TIMES    = 3
-	
+
 	MAX_THREAD_NUM = 1000
 )
 
+var (
+	// 代理IP来源的刷新频率
+	RefreshInterval = 5 * time.Minute
+	// 健康检查的默认目标地址，返回非5xx状态即视为可用，可由SetCheckUrl修改
+	CheckUrl = "http://www.baidu.com/"
+	// 连续失败该次数后临时封禁
+	MaxContinuousFail = 3
+	// 临时封禁时长
+	BanDuration = 10 * time.Minute
+	// 视为封禁页面的响应状态
+	BanStatus = map[int]bool{403: true, 407: true, 429: true}
+	// 正文开头命中任一规则即视为封禁页面
+	BanPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)访问过于频繁|请求过于频繁|访问受限|unusual traffic|too many requests`),
+	}
+
+	ErrBanned = errors.New("代理IP被目标站点封禁")
+)
+
 func New() *Proxy {
 	p := &Proxy{
-		ipRegexp:           regexp.MustCompile(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`),
-		proxyIPTypeRegexp:  regexp.MustCompile(`https?:`)
-		proxyUrlTypeRegexp: regexp.MustCompile(`((https?|ftp):\/\/)?(([^:\n\r]+):([^@\n\r]+)@)?((www\.)?([^/\n\r:]+)):?([0-9]{1,5})?\/?([^?\n\r]+)?\??([^#\n\r]*)?#?([^\n\r]*)`),
-		allIps:             map[string]string{},
-		all:                map[string]bool{},
-		usable:             make(map[string]*ProxyForHost),
-		threadPool:         make(chan bool, MAX_THREAD_NUM),
-		surf:               surfer.New(),
-	}
-	go p.Update()
+		sources:    []ProxySource{NewFileSource(config.PROXY)},
+		bySource:   map[string]map[string]bool{},
+		all:        map[string]bool{},
+		sessions:   map[string]string{},
+		scores:     map[string]*Score{},
+		checkUrl:   CheckUrl,
+		threadPool: make(chan bool, MAX_THREAD_NUM),
+		surf:       surfer.New(),
+	}
+	go func() {
+		p.Update()
+		for {
+			// 每次读取，以便运行中修改刷新频率
+			time.Sleep(RefreshInterval)
+			p.Refresh()
+		}
+	}()
+	go p.watch()
 	return p
 }
 
 
 func (self *Proxy) Count() int32 {
-	return self.online
+	return atomic.LoadInt32(&self.online)
 }
 
 
+// Update 刷新全部来源并重新检查全部代理IP
 func (self *Proxy) Update() *Proxy {
-	f, err := os.Open(config.PROXY)
-	if err != nil {
-		
-		return self
+	self.refresh()
+	self.findOnline()
+	return self
+}
+
+
+// Refresh 刷新全部来源，仅检查新增的代理IP，已移除的代理IP不影响正在进行的请求
+func (self *Proxy) Refresh() *Proxy {
+	self.checkProxys(self.refresh())
+	return self
+}
+
+
+// AddSource 添加代理IP来源，同名来源将被替换；读取与健康检查在后台进行
+func (self *Proxy) AddSource(src ProxySource) *Proxy {
+	self.Lock()
+	for i, s := range self.sources {
+		if s.Name() == src.Name() {
+			self.sources = append(self.sources[:i], self.sources[i+1:]...)
+			break
+		}
 	}
-	b, _ := ioutil.ReadAll(f)
-	f.Close()
+	self.sources = append(self.sources, src)
+	self.Unlock()
+	go self.checkProxys(self.refreshSource(src))
+	return self
+}
+
 
-	proxysIPType := self.proxyIPTypeRegexp.FindAllString(string(b), -1)
-	for _, proxy := range proxysIPType {
-		self.allIps[proxy] = self.ipRegexp.FindString(proxy)
-		self.all[proxy] = false
+// RemoveSource 移除代理IP来源及仅由其提供的代理IP
+func (self *Proxy) RemoveSource(name string) *Proxy {
+	self.Lock()
+	defer self.Unlock()
+	for i, s := range self.sources {
+		if s.Name() == name {
+			self.sources = append(self.sources[:i], self.sources[i+1:]...)
+			break
+		}
 	}
+	self.apply(name, nil)
+	return self
+}
 
-	proxysUrlType := self.proxyUrlTypeRegexp.FindAllString(string(b), -1)
-	for _, proxy := range proxysUrlType {
-		gvalue := self.proxyUrlTypeRegexp.FindStringSubmatch(proxy)
-		self.allIps[proxy] = gvalue[6]
-		self.all[proxy] = false
+
+// watch 本地文件等可感知修改的来源在修改后立即刷新
+func (self *Proxy) watch() {
+	for {
+		time.Sleep(WatchInterval)
+		self.Lock()
+		sources := append([]ProxySource(nil), self.sources...)
+		self.Unlock()
+		for _, src := range sources {
+			if w, ok := src.(WatchedSource); ok && w.Changed() {
+				self.checkProxys(self.refreshSource(src))
+			}
+		}
 	}
+}
 
-	log.Printf(" *     读取代理IP: %v 条\n", len(self.all))
+func (self *Proxy) refresh() (added []string) {
+	self.Lock()
+	sources := append([]ProxySource(nil), self.sources...)
+	self.Unlock()
+	for _, src := range sources {
+		added = append(added, self.refreshSource(src)...)
+	}
+	return
+}
 
-	self.findOnline()
+func (self *Proxy) refreshSource(src ProxySource) []string {
+	proxys, err := src.Fetch()
+	if err != nil {
+		logs.Log.Error(" *     读取代理IP来源 [%v] 失败: %v\n", src.Name(), err)
+		return nil
+	}
+	self.Lock()
+	defer self.Unlock()
+	return self.apply(src.Name(), proxys)
+}
 
-	return self
+// apply 以来源的最新列表替换其旧列表，返回新增的代理IP
+func (self *Proxy) apply(name string, proxys []string) (added []string) {
+	old := self.bySource[name]
+	cur := make(map[string]bool, len(proxys))
+	for _, proxy := range proxys {
+		cur[proxy] = true
+		if _, ok := self.all[proxy]; !ok {
+			self.all[proxy] = false
+			self.scores[proxy] = &Score{}
+			added = append(added, proxy)
+		}
+	}
+	if len(cur) > 0 {
+		self.bySource[name] = cur
+	} else {
+		delete(self.bySource, name)
+	}
+
+	var removed int
+	for proxy := range old {
+		if cur[proxy] {
+			continue
+		}
+		var owned bool
+		for _, m := range self.bySource {
+			if m[proxy] {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			delete(self.all, proxy)
+			delete(self.scores, proxy)
+			removed++
+		}
+	}
+	if len(added) > 0 || removed > 0 {
+		self.countOnline()
+		log.Printf(" *     代理IP来源 [%v]: 新增 %v 条，移除 %v 条，共计 %v 条\n", name, len(added), removed, len(self.all))
+	}
+	return
+}
+
+func (self *Proxy) countOnline() {
+	var online int32
+	for _, alive := range self.all {
+		if alive {
+			online++
+		}
+	}
+	atomic.StoreInt32(&self.online, online)
 }
 
 
+// findOnline 以HTTP请求检查全部代理IP的可用性
 func (self *Proxy) findOnline() *Proxy {
-	log.Printf(" *     正在筛选在线的代理IP……")
-	self.online = 0
+	if !atomic.CompareAndSwapInt32(&self.checking, 0, 1) {
+		return self
+	}
+	defer atomic.StoreInt32(&self.checking, 0)
+	self.Lock()
+	proxys := make([]string, 0, len(self.all))
 	for proxy := range self.all {
+		proxys = append(proxys, proxy)
+	}
+	self.Unlock()
+	return self.checkProxys(proxys)
+}
+
+func (self *Proxy) checkProxys(proxys []string) *Proxy {
+	if len(proxys) == 0 {
+		return self
+	}
+
+	log.Printf(" *     正在筛选在线的代理IP……")
+	var wg sync.WaitGroup
+	for _, proxy := range proxys {
 		self.threadPool <- true
+		wg.Add(1)
 		go func(proxy string) {
-			alive, _, _ := ping.Ping(self.allIps[proxy], CONN_TIMEOUT)
+			defer func() {
+				<-self.threadPool
+				wg.Done()
+			}()
+			alive, timedelay := self.check(proxy, self.getCheckUrl())
 			self.Lock()
+			defer self.Unlock()
+			score, ok := self.scores[proxy]
+			if !ok {
+				// 检查期间已被移除
+				return
+			}
 			self.all[proxy] = alive
-			self.Unlock()
 			if alive {
-				atomic.AddInt32(&self.online, 1)
+				score.succeed(timedelay)
 			}
-			<-self.threadPool
 		}(proxy)
 	}
-	for len(self.threadPool) > 0 {
-		time.Sleep(0.2e9)
-	}
-	self.online = atomic.LoadInt32(&self.online)
-	log.Printf(" *     在线代理IP筛选完成，共计：%v 个\n", self.online)
+	wg.Wait()
+	self.Lock()
+	self.countOnline()
+	self.Unlock()
+	log.Printf(" *     在线代理IP筛选完成，共计：%v 个\n", self.Count())
 
 	return self
 }
 
 
+// UpdateTicker 设置健康检查的频率
 func (self *Proxy) UpdateTicker(tickMinute int64) {
+	self.Lock()
+	defer self.Unlock()
+	if self.ticker != nil {
+		self.ticker.Stop()
+	}
 	self.tickMinute = tickMinute
 	self.ticker = time.NewTicker(time.Duration(self.tickMinute) * time.Minute)
-	for _, proxyForHost := range self.usable {
-		proxyForHost.curIndex++
-		proxyForHost.isEcho = true
-	}
 }
 
 
+// SetCheckUrl 设置健康检查的目标地址，宜选择与目标站点网络环境相近的地址
+func (self *Proxy) SetCheckUrl(u string) *Proxy {
+	self.Lock()
+	self.checkUrl = u
+	self.Unlock()
+	return self
+}
+
+func (self *Proxy) getCheckUrl() string {
+	self.Lock()
+	defer self.Unlock()
+	return self.checkUrl
+}
+
+// GetOne 为每个请求按健康评分加权随机选取一个未被封禁的在线代理IP
 func (self *Proxy) GetOne(u string) (curProxy string) {
-	if self.online == 0 {
-		return
-	}
-	u2, _ := url.Parse(u)
-	if u2.Host == "" {
-		logs.Log.Informational(" *     [%v]设置代理IP失败，目标url不正确\n", u)
+	if self.Count() == 0 {
 		return
 	}
-	var key = u2.Host
-	if strings.Count(key, ".") > 1 {
-		key = key[strings.Index(key, ".")+1:]
-	}
 
 	self.Lock()
 	defer self.Unlock()
+	return self.pick(u)
+}
 
-	var ok = true
-	var proxyForHost = self.usable[key]
+// pick 选取代理IP，调用方需持有锁
+func (self *Proxy) pick(u string) string {
+	if self.ticker != nil {
+		select {
+		case <-self.ticker.C:
+			go self.findOnline()
+		default:
+		}
+	}
 
-	select {
-	case <-self.ticker.C:
-		proxyForHost.curIndex++
-		if proxyForHost.curIndex >= proxyForHost.Len() {
-			_, ok = self.testAndSort(key, u2.Scheme+":"
+	var (
+		now     = time.Now()
+		site    = domain.FromURL(u)
+		total   float64
+		proxys  []string
+		weights []float64
+	)
+	for proxy, online := range self.all {
+		score := self.scores[proxy]
+		if !online || score.Banned(now, site) {
+			continue
+		}
+		w := score.Weight()
+		proxys = append(proxys, proxy)
+		weights = append(weights, w)
+		total += w
+	}
+	if len(proxys) == 0 {
+		logs.Log.Informational(" *     [%v]设置代理IP失败，没有可用的代理IP\n", u)
+		return ""
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r -= w; r <= 0 {
+			return proxys[i]
 		}
-		proxyForHost.isEcho = true
+	}
+	return proxys[len(proxys)-1]
+}
 
-	default:
-		if proxyForHost == nil {
-			self.usable[key] = &ProxyForHost{
-				proxys:    []string{},
-				timedelay: []time.Duration{},
-				isEcho:    true,
-			}
-			proxyForHost, ok = self.testAndSort(key, u2.Scheme+":"
-		} else if l := proxyForHost.Len(); l == 0 {
-			ok = false
-		} else if proxyForHost.curIndex >= l {
-			_, ok = self.testAndSort(key, u2.Scheme+":"
-			proxyForHost.isEcho = true
+
+// GetSticky 返回会话绑定的代理IP，绑定的代理IP离线或被封禁时重新选取，此时renewed为true；
+// 检查与绑定在同一把锁内完成，同一会话的并发请求总是得到同一代理IP
+func (self *Proxy) GetSticky(session string, u string) (curProxy string, renewed bool) {
+	if self.Count() == 0 {
+		return
+	}
+	self.Lock()
+	defer self.Unlock()
+	pinned, ok := self.sessions[session]
+	if ok {
+		if score, found := self.scores[pinned]; found && self.all[pinned] && !score.Banned(time.Now(), domain.FromURL(u)) {
+			return pinned, false
 		}
 	}
-	if !ok {
-		logs.Log.Informational(" *     [%v]设置代理IP失败，没有可用的代理IP\n", key)
+
+	curProxy = self.pick(u)
+	if curProxy == "" {
 		return
 	}
-	curProxy = proxyForHost.proxys[proxyForHost.curIndex]
-	if proxyForHost.isEcho {
-		logs.Log.Informational(" *     设置代理IP为 [%v](%v)\n",
-			curProxy,
-			proxyForHost.timedelay[proxyForHost.curIndex],
-		)
-		proxyForHost.isEcho = false
+	self.sessions[session] = curProxy
+	if ok {
+		logs.Log.Informational(" *     会话 [%v] 的代理IP [%v] 已失效，更换为 [%v]\n", session, pinned, curProxy)
 	}
-	return
+	return curProxy, ok
 }
 
 
-func (self *Proxy) testAndSort(key string, testHost string) (*ProxyForHost, bool) {
-	logs.Log.Informational(" *     [%v]正在测试与排序代理IP……", key)
-	proxyForHost := self.usable[key]
-	proxyForHost.proxys = []string{}
-	proxyForHost.timedelay = []time.Duration{}
-	proxyForHost.curIndex = 0
-	for proxy, online := range self.all {
-		if !online {
-			continue
-		}
-		self.threadPool <- true
-		go func(proxy string) {
-			alive, timedelay := self.findUsable(proxy, testHost)
-			if alive {
-				proxyForHost.Mutex.Lock()
-				proxyForHost.proxys = append(proxyForHost.proxys, proxy)
-				proxyForHost.timedelay = append(proxyForHost.timedelay, timedelay)
-				proxyForHost.Mutex.Unlock()
-			}
-			<-self.threadPool
-		}(proxy)
+// ReleaseSession 解除会话与代理IP的绑定
+func (self *Proxy) ReleaseSession(session string) {
+	self.Lock()
+	delete(self.sessions, session)
+	self.Unlock()
+}
+
+
+// Feedback 根据对链接u的实际抓取结果更新代理IP评分，连续失败过多时临时封禁，
+// 仅在u所属站点连续失败或命中封禁页面(ErrBanned)时仅对该站点封禁
+func (self *Proxy) Feedback(proxy string, u string, err error, latency time.Duration) {
+	site := domain.FromURL(u)
+	if err == ErrBanned {
+		self.Ban(proxy, site, BanDuration)
+		return
+	}
+	self.Lock()
+	defer self.Unlock()
+	score, ok := self.scores[proxy]
+	if !ok {
+		return
 	}
-	for len(self.threadPool) > 0 {
-		time.Sleep(0.2e9)
+	if err == nil {
+		score.succeed(latency)
+		delete(score.SiteFails, site)
+		return
+	}
+	score.fail()
+	if site != "" && score.failSite(site) >= MaxContinuousFail {
+		score.ban(site, time.Now().Add(BanDuration))
+		delete(score.SiteFails, site)
+		logs.Log.Informational(" *     代理IP [%v] 在 [%v] 连续失败 %v 次，对该站点暂停使用 %v\n", proxy, site, MaxContinuousFail, BanDuration)
+	}
+	if score.ContinuousFail >= MaxContinuousFail {
+		score.ban("", time.Now().Add(BanDuration))
+		score.ContinuousFail = 0
+		logs.Log.Informational(" *     代理IP [%v] 连续失败 %v 次，暂停使用 %v\n", proxy, MaxContinuousFail, BanDuration)
+	}
+}
+
+
+// Ban 临时封禁代理IP，site为可注册域名，为空时对全部站点封禁
+func (self *Proxy) Ban(proxy string, site string, d time.Duration) {
+	self.Lock()
+	defer self.Unlock()
+	score, ok := self.scores[proxy]
+	if !ok {
+		return
 	}
-	if proxyForHost.Len() > 0 {
-		sort.Sort(proxyForHost)
-		logs.Log.Informational(" *     [%v]测试与排序代理IP完成，可用：%v 个\n", key, proxyForHost.Len())
-		return proxyForHost, true
+	score.fail()
+	score.ContinuousFail = 0
+	score.ban(site, time.Now().Add(d))
+	logs.Log.Informational(" *     代理IP [%v] 疑似被 [%v] 封禁，暂停使用 %v\n", proxy, site, d)
+}
+
+
+// Scores 返回全部代理IP评分的快照
+func (self *Proxy) Scores() map[string]Score {
+	self.Lock()
+	defer self.Unlock()
+	scores := make(map[string]Score, len(self.scores))
+	for proxy, score := range self.scores {
+		s := *score
+		s.SiteBans = make(map[string]time.Time, len(score.SiteBans))
+		for site, until := range score.SiteBans {
+			s.SiteBans[site] = until
+		}
+		s.SiteFails = make(map[string]int, len(score.SiteFails))
+		for site, n := range score.SiteFails {
+			s.SiteFails[site] = n
+		}
+		scores[proxy] = s
 	}
-	logs.Log.Informational(" *     [%v]测试与排序代理IP完成，没有可用的代理IP\n", key)
-	return proxyForHost, false
+	return scores
 }
 
 
-func (self *Proxy) findUsable(proxy string, testHost string) (alive bool, timedelay time.Duration) {
+func (self *Proxy) check(proxy, checkUrl string) (alive bool, timedelay time.Duration) {
 	t0 := time.Now()
 	req := &request.Request{
-		Url:         testHost,
+		Url:         checkUrl,
 		Method:      "HEAD",
 		Header:      make(http.Header),
 		DialTimeout: time.Second * time.Duration(DAIL_TIMEOUT),
@@ -235,10 +474,39 @@ func (self *Proxy) findUsable(proxy string, testHost string) (alive bool, timede
 	}
 	req.SetProxy(proxy)
 	resp, err := self.surf.Download(req)
-
-	if resp.StatusCode != http.StatusOK {
+	if err != nil || resp == nil {
 		return false, 0
 	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || BanStatus[resp.StatusCode] {
+		return false, 0
+	}
+	return true, time.Since(t0)
+}
 
-	return err == nil, time.Since(t0)
+
+// IsBanPage 根据状态码与正文开头判断是否为封禁页面，不影响后续读取正文
+func IsBanPage(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if BanStatus[resp.StatusCode] {
+		return true
+	}
+	if len(BanPatterns) == 0 || resp.Body == nil {
+		return false
+	}
+	head := make([]byte, 2048)
+	n, _ := io.ReadFull(resp.Body, head)
+	head = head[:n]
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	for _, re := range BanPatterns {
+		if re.Match(head) {
+			return true
+		}
+	}
+	return false
 }
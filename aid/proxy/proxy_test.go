@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-spider/downloader/surfer"
+)
+
+// fakeSurfer 总是返回200
+type fakeSurfer struct{}
+
+func (self *fakeSurfer) Download(req surfer.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func newTestProxy(online ...string) *Proxy {
+	p := &Proxy{
+		bySource:   map[string]map[string]bool{},
+		all:        map[string]bool{},
+		sessions:   map[string]string{},
+		scores:     map[string]*Score{},
+		checkUrl:   CheckUrl,
+		threadPool: make(chan bool, MAX_THREAD_NUM),
+		surf:       &fakeSurfer{},
+	}
+	for _, proxy := range online {
+		p.all[proxy] = true
+		p.scores[proxy] = &Score{}
+	}
+	p.countOnline()
+	return p
+}
+
+func TestParseText(t *testing.T) {
+	text := `# 注释 1.1.1.1:80
+http://1.2.3.4:80
+1.2.3.4:8080 高匿 2018-01-01
+
+代理：socks5://u:p@proxy.example.com:1080，备用 5.6.7.8:3128
+no proxy here`
+	want := []string{
+		"http://1.2.3.4:80",
+		"1.2.3.4:8080",
+		"socks5://u:p@proxy.example.com:1080",
+		"5.6.7.8:3128",
+	}
+	if got := ParseText(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestScoreWeight(t *testing.T) {
+	good, bad, slow := &Score{}, &Score{}, &Score{}
+	for i := 0; i < 10; i++ {
+		good.succeed(100 * time.Millisecond)
+		bad.fail()
+		slow.succeed(5 * time.Second)
+	}
+	if good.Weight() <= bad.Weight() {
+		t.Errorf("good %v <= bad %v", good.Weight(), bad.Weight())
+	}
+	if good.Weight() <= slow.Weight() {
+		t.Errorf("good %v <= slow %v", good.Weight(), slow.Weight())
+	}
+	if bad.ContinuousFail != 10 {
+		t.Errorf("ContinuousFail = %d", bad.ContinuousFail)
+	}
+	bad.succeed(time.Second)
+	if bad.ContinuousFail != 0 {
+		t.Errorf("ContinuousFail not reset: %d", bad.ContinuousFail)
+	}
+}
+
+func TestScoreBanned(t *testing.T) {
+	now := time.Now()
+	s := &Score{}
+	s.ban("example.com", now.Add(time.Minute))
+	if !s.Banned(now, "example.com") || s.Banned(now, "other.com") {
+		t.Error("site ban should only apply to its site")
+	}
+	if s.Banned(now.Add(2*time.Minute), "example.com") {
+		t.Error("site ban should expire")
+	}
+	s.ban("", now.Add(time.Minute))
+	if !s.Banned(now, "other.com") {
+		t.Error("global ban should apply to every site")
+	}
+}
+
+func TestFeedbackBan(t *testing.T) {
+	p := newTestProxy("http://1.1.1.1:80")
+	for i := 0; i < MaxContinuousFail; i++ {
+		p.Feedback("http://1.1.1.1:80", "http://www.example.com/", http.ErrHandlerTimeout, 0)
+	}
+	if !p.scores["http://1.1.1.1:80"].Banned(time.Now(), "") {
+		t.Error("proxy should be banned after continuous failures")
+	}
+
+	p = newTestProxy("http://1.1.1.1:80")
+	p.Feedback("http://1.1.1.1:80", "http://www.example.com/a", ErrBanned, 0)
+	score := p.scores["http://1.1.1.1:80"]
+	if !score.Banned(time.Now(), "example.com") || score.Banned(time.Now(), "other.com") {
+		t.Error("ban page should ban the proxy for its site only")
+	}
+}
+
+func TestGetOneRotation(t *testing.T) {
+	p := newTestProxy("http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80")
+	p.all["http://3.3.3.3:80"] = false
+	p.scores["http://2.2.2.2:80"].ban("example.com", time.Now().Add(time.Minute))
+
+	for i := 0; i < 50; i++ {
+		if got := p.GetOne("http://www.example.com/"); got != "http://1.1.1.1:80" {
+			t.Fatalf("got %q, want the only usable proxy", got)
+		}
+	}
+
+	// 其他站点不受影响，按权重轮换
+	for i := 0; i < 20; i++ {
+		p.scores["http://1.1.1.1:80"].succeed(100 * time.Millisecond)
+		p.scores["http://2.2.2.2:80"].fail()
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[p.GetOne("http://other.com/")]++
+	}
+	if counts["http://1.1.1.1:80"] <= counts["http://2.2.2.2:80"] {
+		t.Errorf("unexpected rotation: %v", counts)
+	}
+}
+
+func TestFeedbackSiteFail(t *testing.T) {
+	p := newTestProxy("http://1.1.1.1:80")
+	score := p.scores["http://1.1.1.1:80"]
+	for i := 0; i < MaxContinuousFail; i++ {
+		p.Feedback("http://1.1.1.1:80", "http://www.example.com/a", http.ErrHandlerTimeout, 0)
+		// 其他站点的成功不重置该站点的连续失败
+		p.Feedback("http://1.1.1.1:80", "http://other.com/", nil, time.Second)
+	}
+	now := time.Now()
+	if !score.Banned(now, "example.com") || score.Banned(now, "other.com") {
+		t.Error("proxy failing on one site should be banned for that site only")
+	}
+
+	p = newTestProxy("http://1.1.1.1:80")
+	score = p.scores["http://1.1.1.1:80"]
+	for i := 0; i < MaxContinuousFail*2; i++ {
+		err := error(http.ErrHandlerTimeout)
+		if i%2 == 1 {
+			err = nil
+		}
+		p.Feedback("http://1.1.1.1:80", "http://www.example.com/a", err, time.Second)
+	}
+	if score.Banned(time.Now(), "example.com") {
+		t.Error("success on the site should reset its failures")
+	}
+}
+
+func TestGetStickyConcurrent(t *testing.T) {
+	p := newTestProxy("http://1.1.1.1:80", "http://2.2.2.2:80", "http://3.3.3.3:80")
+	var (
+		wg  sync.WaitGroup
+		got = make([]string, 50)
+	)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], _ = p.GetSticky("s", "http://www.example.com/")
+		}(i)
+	}
+	wg.Wait()
+	for _, proxy := range got {
+		if proxy != got[0] || proxy == "" {
+			t.Fatalf("session got different proxies: %q", got)
+		}
+	}
+}
+
+func TestGetStickyRenew(t *testing.T) {
+	p := newTestProxy("http://1.1.1.1:80", "http://2.2.2.2:80")
+	pinned, renewed := p.GetSticky("s", "http://www.example.com/")
+	if pinned == "" || renewed {
+		t.Fatalf("pinned = %q, renewed = %v", pinned, renewed)
+	}
+	if again, renewed := p.GetSticky("s", "http://www.example.com/b"); again != pinned || renewed {
+		t.Errorf("pin not kept: %q, renewed = %v", again, renewed)
+	}
+
+	p.Ban(pinned, "example.com", time.Minute)
+	cur, renewed := p.GetSticky("s", "http://www.example.com/")
+	if cur == pinned || cur == "" || !renewed {
+		t.Errorf("after ban: %q, renewed = %v", cur, renewed)
+	}
+
+	p.ReleaseSession("s")
+	if _, ok := p.sessions["s"]; ok {
+		t.Error("session not released")
+	}
+	if _, renewed := p.GetSticky("s", "http://www.example.com/"); renewed {
+		t.Error("released session should start fresh, not renewed")
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"math"
+	"time"
+)
+
+// Score 单个代理IP的健康状况，由健康检查与实际抓取结果共同更新
+type Score struct {
+	Succ           int64
+	Fail           int64
+	Latency        time.Duration // 响应耗时的指数加权平均
+	ContinuousFail int
+	BannedUntil    time.Time
+	SiteBans       map[string]time.Time // 按可注册域名记录的封禁，仅对该站点生效
+	SiteFails      map[string]int       // 按可注册域名记录的连续失败次数
+}
+
+const latencyAlpha = 0.3
+
+func (self *Score) succeed(latency time.Duration) {
+	self.Succ++
+	self.ContinuousFail = 0
+	if self.Latency == 0 {
+		self.Latency = latency
+	} else {
+		self.Latency = time.Duration(latencyAlpha*float64(latency) + (1-latencyAlpha)*float64(self.Latency))
+	}
+}
+
+func (self *Score) fail() {
+	self.Fail++
+	self.ContinuousFail++
+}
+
+// failSite 记录一次对site的失败，返回其连续失败次数
+func (self *Score) failSite(site string) int {
+	if self.SiteFails == nil {
+		self.SiteFails = make(map[string]int)
+	}
+	self.SiteFails[site]++
+	return self.SiteFails[site]
+}
+
+// Banned 对于site（可注册域名，为空时仅判断全局封禁）是否处于封禁期
+func (self *Score) Banned(now time.Time, site string) bool {
+	if now.Before(self.BannedUntil) {
+		return true
+	}
+	if until, ok := self.SiteBans[site]; ok {
+		if now.Before(until) {
+			return true
+		}
+		delete(self.SiteBans, site)
+	}
+	return false
+}
+
+func (self *Score) ban(site string, until time.Time) {
+	if site == "" {
+		self.BannedUntil = until
+		return
+	}
+	if self.SiteBans == nil {
+		self.SiteBans = make(map[string]time.Time)
+	}
+	self.SiteBans[site] = until
+}
+
+// Weight 轮换时的权重，成功率越高、延迟越低权重越大
+func (self *Score) Weight() float64 {
+	rate := float64(self.Succ+1) / float64(self.Succ+self.Fail+2)
+	return rate * rate / (1 + math.Max(self.Latency.Seconds(), 0))
+}
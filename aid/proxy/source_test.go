@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	cases := map[string][]string{
+		`["http://1.1.1.1:80", "2.2.2.2:8080"]`:                                               {"http://1.1.1.1:80", "2.2.2.2:8080"},
+		`{"data": [{"proxy": "http://1.1.1.1:80"}, {"url": "socks5://2.2.2.2:1080"}]}`:        {"http://1.1.1.1:80", "socks5://2.2.2.2:1080"},
+		`[{"ip": "3.3.3.3", "port": 3128, "type": "HTTPS"}, {"ip": "4.4.4.4", "port": "80"}]`: {"https://3.3.3.3:3128", "http://4.4.4.4:80"},
+	}
+	for in, want := range cases {
+		got, err := ParseJSON([]byte(in))
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", in, got, want)
+		}
+	}
+	if _, err := ParseJSON([]byte(`{"code": 0}`)); err == nil {
+		t.Error("want error for unsupported format")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.lib")
+	src := NewFileSource(path)
+
+	if proxys, err := src.Fetch(); err != nil || len(proxys) != 0 {
+		t.Fatalf("missing file: %v, %v", proxys, err)
+	}
+	if src.Changed() {
+		t.Error("missing file reported as changed")
+	}
+
+	ioutil.WriteFile(path, []byte("1.1.1.1:80\n"), 0644)
+	if !src.Changed() {
+		t.Error("created file not reported as changed")
+	}
+	if proxys, _ := src.Fetch(); !reflect.DeepEqual(proxys, []string{"1.1.1.1:80"}) {
+		t.Errorf("got %q", proxys)
+	}
+	if src.Changed() {
+		t.Error("unchanged file reported as changed")
+	}
+
+	later := time.Now().Add(time.Minute)
+	ioutil.WriteFile(path, []byte("1.1.1.1:80\n2.2.2.2:80\n"), 0644)
+	os.Chtimes(path, later, later)
+	if !src.Changed() {
+		t.Error("modified file not reported as changed")
+	}
+	if proxys, _ := src.Fetch(); len(proxys) != 2 {
+		t.Errorf("got %q", proxys)
+	}
+
+	os.Remove(path)
+	if !src.Changed() {
+		t.Error("removed file not reported as changed")
+	}
+}
+
+func TestApplyDiff(t *testing.T) {
+	p := newTestProxy()
+	added := p.apply("a", []string{"1.1.1.1:80", "2.2.2.2:80"})
+	sort.Strings(added)
+	if !reflect.DeepEqual(added, []string{"1.1.1.1:80", "2.2.2.2:80"}) {
+		t.Errorf("added = %q", added)
+	}
+	// 其他来源也提供的代理IP不随本来源移除
+	p.apply("b", []string{"2.2.2.2:80"})
+	added = p.apply("a", []string{"3.3.3.3:80"})
+	if !reflect.DeepEqual(added, []string{"3.3.3.3:80"}) {
+		t.Errorf("added = %q", added)
+	}
+	var all []string
+	for proxy := range p.all {
+		all = append(all, proxy)
+	}
+	sort.Strings(all)
+	if !reflect.DeepEqual(all, []string{"2.2.2.2:80", "3.3.3.3:80"}) {
+		t.Errorf("all = %q", all)
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"io"
 	"reflect"
 	"strconv"
@@ -26,6 +27,7 @@ type (
 		GetAppConf(k ...string) interface{}
 		SetAppConf(k string, v interface{}) App
 		SpiderPrepare(original []*spider.Spider) App
+		PrepareErr() error
 
 		Run()
 		Stop()
@@ -38,6 +40,10 @@ type (
 		GetSpiderLib() []*spider.Spider
 		GetSpiderByName(string) *spider.Spider
 		GetSpiderQueue() crawler.SpiderQueue
+		Preview(spiderName, ruleName, url, keyin string, params map[string]interface{}, file string) (*crawler.PreviewResult, error)
+		SetChains(chains ...crawler.Chain) App
+		SetParams(spiderName string, sets ...map[string]interface{}) App
+		SetProxies(proxys ...string) App
 		GetOutputLib() []string
 		GetTaskJar() *distribute.TaskJar
 		distribute.Distributer
@@ -55,6 +61,10 @@ type (
 		finish                chan bool
 		finishOnce            sync.Once
 		canSocketLog          bool
+		chains                []crawler.Chain
+		params                map[string][]map[string]interface{}
+		prepareErr            error           // 最近一次SpiderPrepare的错误，非nil时本批任务不运行
+		proxies               []string        // 随任务下发的代理IP列表
 		sync.RWMutex
 	}
 )
@@ -114,6 +124,7 @@ func (self *Logic) Init(mode int, port int, master string, w ...io.Writer) App {
 	self.TaskJar = distribute.NewTaskJar()
 	self.SpiderQueue = crawler.NewSpiderQueue()
 	self.CrawlerPool = crawler.NewCrawlerPool()
+	spider.StartWatch()
 
 	switch self.AppConf.Mode {
 	case status.SERVER:
@@ -154,6 +165,7 @@ func (self *Logic) ReInit(mode int, port int, master string, w ...io.Writer) App
 }
 
 func (self *Logic) SpiderPrepare(original []*spider.Spider) App {
+	self.prepareErr = nil
 	self.SpiderQueue.Reset()
 	for _, sp := range original {
 		spcopy := sp.Copy()
@@ -166,9 +178,55 @@ func (self *Logic) SpiderPrepare(original []*spider.Spider) App {
 		self.SpiderQueue.Add(spcopy)
 	}
 	self.SpiderQueue.AddKeyins(self.AppConf.Keyins)
+	if err := self.SpiderQueue.AddParams(self.params); err != nil {
+		logs.Log.Error(" *     任务准备失败，本批任务不会运行: %v\n", err)
+		self.SpiderQueue.Reset()
+		self.prepareErr = err
+		return self
+	}
+	self.applyChains(self.chains)
+	return self
+}
+
+// PrepareErr 返回最近一次SpiderPrepare的错误，如必填参数未提供
+func (self *Logic) PrepareErr() error {
+	return self.prepareErr
+}
+
+// SetChains 声明蜘蛛间的串联，在每次SpiderPrepare时应用于本批任务
+func (self *Logic) SetChains(chains ...crawler.Chain) App {
+	self.chains = chains
 	return self
 }
 
+// SetParams 设置蜘蛛的参数组，每组生成一个任务，在每次SpiderPrepare时应用；sets为空时清除
+func (self *Logic) SetParams(spiderName string, sets ...map[string]interface{}) App {
+	if self.params == nil {
+		self.params = make(map[string][]map[string]interface{})
+	}
+	if len(sets) == 0 {
+		delete(self.params, spiderName)
+	} else {
+		self.params[spiderName] = sets
+	}
+	return self
+}
+
+// SetProxies 设置随任务下发的代理IP列表，与本地代理IP来源一同使用；为空时清除
+func (self *Logic) SetProxies(proxys ...string) App {
+	self.proxies = proxys
+	scheduler.SetTaskProxies(proxys)
+	return self
+}
+
+func (self *Logic) applyChains(chains []crawler.Chain) {
+	for _, c := range chains {
+		if err := self.SpiderQueue.AddChain(c); err != nil {
+			logs.Log.Error(" *     串联 %s -> %s: %v\n", c.From, c.To, err)
+		}
+	}
+}
+
 func (self *Logic) GetOutputLib() []string {
 	return collector.DataOutputLib
 }
@@ -181,6 +239,17 @@ func (self *Logic) GetSpiderByName(name string) *spider.Spider {
 	return self.SpiderSpecies.GetByName(name)
 }
 
+// Preview 以指定规则试抓单个链接（file非空时读取本地文件），返回其输出的数据与将入队的请求，不影响输出与历史记录；
+// keyin与params仅作用于预览使用的副本
+func (self *Logic) Preview(spiderName, ruleName, url, keyin string, params map[string]interface{}, file string) (*crawler.PreviewResult, error) {
+	sp := self.GetSpiderByName(spiderName)
+	if sp == nil {
+		return nil, fmt.Errorf("蜘蛛 %s 不存在", spiderName)
+	}
+	res := crawler.Preview(sp, ruleName, url, keyin, params, file)
+	return res, res.Err
+}
+
 func (self *Logic) GetMode() int {
 	return self.AppConf.Mode
 }
@@ -295,13 +364,20 @@ func (self *Logic) addNewTask() (tasksNum, spidersNum int) {
 	self.setTask(&t)
 
 	for i, sp := range self.SpiderQueue.GetAll() {
-		t.Spiders = append(t.Spiders, map[string]string{"name": sp.GetName(), "keyin": sp.GetKeyin()})
+		one := distribute.TaskSpider{Name: sp.GetName()}
+		if len(sp.Params) > 0 {
+			one.Params = sp.GetParams()
+		} else {
+			one.Keyin = sp.GetKeyin()
+		}
+		t.Spiders = append(t.Spiders, one)
 		spidersNum++
-		if i > 0 && i%10 == 0 && length > 10 {
+		// 串联的上下游须在同一节点运行
+		if i > 0 && i%10 == 0 && length > 10 && len(t.Chains) == 0 {
 			one := t
 			self.TaskJar.Push(&one)
 			tasksNum++
-			t.Spiders = []map[string]string{}
+			t.Spiders = []distribute.TaskSpider{}
 		}
 	}
 
@@ -356,7 +432,7 @@ func (self *Logic) taskToRun(t *distribute.Task) {
 	self.SpiderQueue.Reset()
 	self.setAppConf(t)
 	for _, n := range t.Spiders {
-		sp := self.GetSpiderByName(n["name"])
+		sp := self.GetSpiderByName(n.Name)
 		if sp == nil {
 			continue
 		}
@@ -367,11 +443,19 @@ func (self *Logic) taskToRun(t *distribute.Task) {
 		} else {
 			spcopy.SetLimit(-1 * t.Limit)
 		}
-		if v, ok := n["keyin"]; ok {
-			spcopy.SetKeyin(v)
+		if len(spcopy.Params) == 0 {
+			spcopy.SetKeyin(n.Keyin)
+		} else if err := spcopy.SetParams(n.Params); err != nil {
+			logs.Log.Error(" *     %v\n", err)
+			continue
 		}
 		self.SpiderQueue.Add(spcopy)
 	}
+	chains := make([]crawler.Chain, 0, len(t.Chains))
+	for _, c := range t.Chains {
+		chains = append(chains, crawler.Chain(c))
+	}
+	self.applyChains(chains)
 }
 
 func (self *Logic) exec() {
@@ -379,7 +463,7 @@ func (self *Logic) exec() {
 	cache.ResetPageCount()
 	pipeline.RefreshOutput()
 	scheduler.Init()
-	crawlerCap := self.CrawlerPool.Reset(count)
+	self.CrawlerPool.Reset(count)
 	cache.StartTime = time.Now()
 	if self.AppConf.Mode == status.OFFLINE {
 		go self.goRun(count)
@@ -451,6 +535,10 @@ func (self *Logic) goRun(count int) {
 		logs.Log.App(" *                            —— %s合计采集【数据 %v 条 + 文件 %v 个】，实爬【成功 %v URL + 失败 %v URL = 合计 %v URL】，耗时【%v】 ——",
 			prefix, self.sum[0], self.sum[1], cache.GetPageCount(1), cache.GetPageCount(-1), cache.GetPageCount(0), self.takeTime)
 	}
+	for _, s := range scheduler.SiteStats() {
+		logs.Log.App(" *     [站点：%s]   请求 %v 次，成功 %v 次，失败 %v 次，平均耗时 %v\n",
+			s.Site, s.Requests, s.Success, s.Failure, s.Latency)
+	}
 	
 	if self.AppConf.Mode == status.OFFLINE {
 		self.finishOnce.Do(func() { close(self.finish) })
@@ -494,7 +582,7 @@ func (self *Logic) setAppConf(task *distribute.Task) {
 	self.AppConf.FailureInherit = task.FailureInherit
 	self.AppConf.Limit = task.Limit
 	self.AppConf.ProxyMinute = task.ProxyMinute
-	self.AppConf.Keyins = task.Keyins
+	self.SetProxies(task.Proxies...)
 }
 func (self *Logic) setTask(task *distribute.Task) {
 	task.ThreadNum = self.AppConf.ThreadNum
@@ -505,5 +593,9 @@ func (self *Logic) setTask(task *distribute.Task) {
 	task.FailureInherit = self.AppConf.FailureInherit
 	task.Limit = self.AppConf.Limit
 	task.ProxyMinute = self.AppConf.ProxyMinute
-	task.Keyins = self.AppConf.Keyins
+	task.Proxies = self.proxies
+	task.Chains = nil
+	for _, c := range self.chains {
+		task.Chains = append(task.Chains, distribute.TaskChain(c))
+	}
 }
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-spider/crawler"
+	"go-spider/distribute"
+	"go-spider/runtime/cache"
+	"go-spider/spider"
+)
+
+func TestLogicPreview(t *testing.T) {
+	sp := spider.Spider{
+		Name:  "app_preview_test",
+		Keyin: "orig",
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{
+			"list": {ParseFunc: func(ctx *spider.Context) {
+				ctx.Output(map[string]interface{}{"keyin": ctx.GetKeyin()})
+			}},
+		}},
+	}.Register()
+	defer spider.Species.Remove(sp.GetName())
+
+	dir, err := ioutil.TempDir("", "preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "list.html")
+	ioutil.WriteFile(file, []byte(`<p>a</p>`), 0644)
+
+	logic := &Logic{SpiderSpecies: spider.Species}
+	res, err := logic.Preview(sp.GetName(), "list", "http://example.com/", "kw", nil, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 1 || res.Items[0]["Data"].(map[string]interface{})["keyin"] != "kw" {
+		t.Errorf("got %v", res.Items)
+	}
+	if sp.GetKeyin() != "orig" {
+		t.Errorf("registered spider keyin changed to %q", sp.GetKeyin())
+	}
+
+	if _, err := logic.Preview("no_such_spider", "list", "http://example.com/", "", nil, file); err == nil {
+		t.Error("want error for unknown spider")
+	}
+}
+
+func registerParamSpider(name string) *spider.Spider {
+	return spider.Spider{
+		Name:     name,
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}},
+		Params: []*spider.Param{
+			{SchemaField: spider.SchemaField{Name: "city", Required: true}},
+			{SchemaField: spider.SchemaField{Name: "pages", Type: spider.FIELD_INT, Default: 5}},
+		},
+	}.Register()
+}
+
+func newTestLogic() *Logic {
+	return &Logic{
+		AppConf:       &cache.AppConf{},
+		SpiderSpecies: spider.Species,
+		TaskJar:       distribute.NewTaskJar(),
+		SpiderQueue:   crawler.NewSpiderQueue(),
+	}
+}
+
+func TestSpiderPrepareRequiredParam(t *testing.T) {
+	sp := registerParamSpider("app_required_test")
+	defer spider.Species.Remove(sp.GetName())
+
+	logic := newTestLogic()
+	logic.SpiderPrepare([]*spider.Spider{sp})
+	if logic.PrepareErr() == nil || logic.GetSpiderQueue().Len() != 0 {
+		t.Fatalf("missing required param: err = %v, %d spiders queued", logic.PrepareErr(), logic.GetSpiderQueue().Len())
+	}
+
+	logic.SetParams(sp.GetName(), map[string]interface{}{"city": "beijing"})
+	logic.SpiderPrepare([]*spider.Spider{sp})
+	if err := logic.PrepareErr(); err != nil || logic.GetSpiderQueue().Len() != 1 {
+		t.Errorf("err = %v, %d spiders queued", err, logic.GetSpiderQueue().Len())
+	}
+}
+
+func TestTaskParams(t *testing.T) {
+	sp := registerParamSpider("app_task_params_test")
+	defer spider.Species.Remove(sp.GetName())
+	plain := spider.Spider{
+		Name:     "app_task_keyin_test",
+		Keyin:    spider.KEYIN,
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}},
+	}.Register()
+	defer spider.Species.Remove(plain.GetName())
+
+	master := newTestLogic()
+	master.SetParams(sp.GetName(), map[string]interface{}{"city": "beijing", "pages": "3"})
+	master.SpiderPrepare([]*spider.Spider{sp})
+	kw := plain.Copy()
+	kw.SetKeyin("kw")
+	master.SpiderQueue.Add(kw)
+	if tasksNum, _ := master.addNewTask(); tasksNum != 1 {
+		t.Fatalf("got %d tasks", tasksNum)
+	}
+
+	// 经由JSON下发至节点
+	b, err := json.Marshal(master.TaskJar.Pull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &distribute.Task{}
+	if err := json.Unmarshal(b, task); err != nil {
+		t.Fatal(err)
+	}
+
+	slave := newTestLogic()
+	slave.taskToRun(task)
+	if slave.SpiderQueue.Len() != 2 {
+		t.Fatalf("got %d spiders", slave.SpiderQueue.Len())
+	}
+	got := slave.SpiderQueue.GetByIndex(0)
+	if got.GetParam("city") != "beijing" || got.GetParam("pages") != int64(3) {
+		t.Errorf("params = %v", got.GetParams())
+	}
+	if k := slave.SpiderQueue.GetByIndex(1).GetKeyin(); k != "kw" {
+		t.Errorf("keyin = %q", k)
+	}
+}
+
+func TestTaskChains(t *testing.T) {
+	var names []string
+	for _, name := range []string{"app_chain_down_test", "app_chain_up_test"} {
+		sp := spider.Spider{Name: name, RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}}}.Register()
+		defer spider.Species.Remove(sp.GetName())
+		names = append(names, sp.GetName())
+	}
+	master := newTestLogic()
+	master.SetChains(crawler.Chain{From: names[1], To: names[0], Field: "id"})
+	for _, name := range names {
+		master.SpiderQueue.Add(master.GetSpiderByName(name).Copy())
+	}
+	master.addNewTask()
+
+	b, err := json.Marshal(master.TaskJar.Pull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &distribute.Task{}
+	if err := json.Unmarshal(b, task); err != nil {
+		t.Fatal(err)
+	}
+	if len(task.Chains) != 1 || task.Chains[0].From != names[1] {
+		t.Fatalf("chains = %+v", task.Chains)
+	}
+
+	// 节点应用串联后上游排在下游之前
+	slave := newTestLogic()
+	slave.taskToRun(task)
+	if slave.SpiderQueue.Len() != 2 || slave.SpiderQueue.GetByIndex(0).GetName() != names[1] {
+		t.Errorf("chain not applied: %v", slave.SpiderQueue.GetAll())
+	}
+}
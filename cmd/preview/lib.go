@@ -0,0 +1,5 @@
+package main
+
+// 在此以空白导入加入Go编写的蜘蛛库，其init中注册的蜘蛛即可预览，如：
+//
+//	import _ "example.com/myspiders/lib"
@@ -0,0 +1,50 @@
+// 预览命令：以指定规则试抓单个链接或本地文件，打印将输出的数据与将入队的请求，不写入输出与历史记录。
+//
+//	preview -spider 名称 -rule 规则 -url 链接 [-file 本地文件] [-keyin 自定义配置] [-params '{"city":"beijing"}']
+//
+// 动态规则（XML/JS）在启动时自动加载；Go编写的蜘蛛库需在 lib.go 中以空白导入加入后重新编译。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	app "go-spider"
+)
+
+func main() {
+	var (
+		spiderName = flag.String("spider", "", "蜘蛛名称")
+		ruleName   = flag.String("rule", "", "规则名称")
+		url        = flag.String("url", "", "链接；指定-file时用于补全相对链接")
+		file       = flag.String("file", "", "读取本地文件代替下载")
+		keyin      = flag.String("keyin", "", "自定义配置")
+		paramsJson = flag.String("params", "", "蜘蛛参数，JSON对象，按蜘蛛的参数声明校验")
+	)
+	flag.Parse()
+	if *spiderName == "" || *ruleName == "" || *url == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var params map[string]interface{}
+	if *paramsJson != "" {
+		// 保留数字原文，整数参数不经float64转换
+		dec := json.NewDecoder(strings.NewReader(*paramsJson))
+		dec.UseNumber()
+		if err := dec.Decode(&params); err != nil {
+			fmt.Fprintln(os.Stderr, "-params:", err)
+			os.Exit(2)
+		}
+	}
+	res, err := app.LogicApp.Preview(*spiderName, *ruleName, *url, *keyin, params, *file)
+	if res != nil {
+		res.Print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
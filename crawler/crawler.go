@@ -2,12 +2,14 @@ package crawler
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"runtime"
 	"time"
 	"go-spider/downloader"
 	"go-spider/downloader/request"
 	"go-spider/pipeline"
+	"go-spider/scheduler"
 	"go-spider/spider"
 	"go-spider/logs"
 	"go-spider/runtime/cache"
@@ -118,6 +120,7 @@ func (self *crawler) Process(req *request.Request) {
 				
 				cache.PageFailCount()
 			}
+			sp.RequestFailed(req, fmt.Errorf("panic: %v", p))
 			
 			stack := make([]byte, 4<<10) 
 			length := runtime.Stack(stack, true)
@@ -133,9 +136,13 @@ func (self *crawler) Process(req *request.Request) {
 		}
 	}()
 
+	scheduler.WaitSite(downUrl)
+	var t0 = time.Now()
 	var ctx = self.Downloader.Download(sp, req) 
 
-	if err := ctx.GetError(); err != nil {
+	err := scheduler.ProxyFeedback(req, ctx.Response, ctx.GetError(), time.Since(t0))
+	scheduler.SiteFeedback(downUrl, err, time.Since(t0))
+	if err != nil {
 		
 		if sp.DoHistory(req, false) {
 			
@@ -143,6 +150,7 @@ func (self *crawler) Process(req *request.Request) {
 		}
 		
 		logs.Log.Error(" *     Fail  [download][%v]: %v\n", downUrl, err)
+		sp.RequestFailed(req, err)
 		return
 	}
 
@@ -157,6 +165,7 @@ func (self *crawler) Process(req *request.Request) {
 	}
 	
 	for _, item := range ctx.PullItems() {
+		sp.Emit(item)
 		if self.Pipeline.CollectData(item) != nil {
 			break
 		}
@@ -164,6 +173,7 @@ func (self *crawler) Process(req *request.Request) {
 
 	
 	sp.DoHistory(req, true)
+	sp.RequestSucceeded(req)
 
 	
 	cache.PageSuccCount()
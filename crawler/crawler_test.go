@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/runtime/cache"
+	"go-spider/runtime/status"
+	"go-spider/spider"
+)
+
+// fakeDownloader err非nil时下载失败，否则返回空白页面
+type fakeDownloader struct {
+	err error
+}
+
+func (self *fakeDownloader) Download(sp *spider.Spider, req *request.Request) *spider.Context {
+	ctx := spider.GetContext(sp, req)
+	if self.err != nil {
+		ctx.SetError(self.err)
+		return ctx
+	}
+	return ctx.SetResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	})
+}
+
+func TestProcessOnError(t *testing.T) {
+	// 服务端模式下调度不读取历史记录
+	mode := cache.Task.Mode
+	cache.Task.Mode = status.SERVER
+	defer func() { cache.Task.Mode = mode }()
+
+	var errs []string
+	sp := &spider.Spider{
+		Name: "crawler_onerror_test",
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{
+			"boom": {ParseFunc: func(ctx *spider.Context) { panic("boom") }},
+		}},
+		OnError: func(self *spider.Spider, req *request.Request, err error) {
+			errs = append(errs, req.GetUrl()+" "+err.Error())
+		},
+	}
+	sp.ReqmatrixInit().Start()
+
+	c := &crawler{Spider: sp, Downloader: &fakeDownloader{err: errors.New("timeout")}}
+	req := &request.Request{Url: "http://example.com/a", Rule: "boom"}
+	req.Prepare()
+	c.Process(req)
+
+	c.Downloader = &fakeDownloader{}
+	req = &request.Request{Url: "http://example.com/b", Rule: "boom"}
+	req.Prepare()
+	c.Process(req)
+
+	want := []string{"http://example.com/a timeout", "http://example.com/b panic: boom"}
+	if len(errs) != 2 || errs[0] != want[0] || errs[1] != want[1] {
+		t.Errorf("got %q, want %q", errs, want)
+	}
+	if s := sp.Stat(); s.Failure != 2 {
+		t.Errorf("Failure = %d", s.Failure)
+	}
+}
@@ -0,0 +1,139 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"go-spider/downloader"
+	"go-spider/downloader/request"
+	"go-spider/pipeline/collector/data"
+	"go-spider/spider"
+)
+
+// PreviewResult 单链接预览的结果
+type PreviewResult struct {
+	Spider   string
+	Rule     string
+	Url      string
+	Items    []data.DataCell
+	Files    []string // 仅记录文件名
+	Requests []*request.Request
+	Err      error
+}
+
+// Preview 以sp的副本下载单个链接（file非空时读取本地文件，url用于补全相对链接），
+// 按ruleName规则解析并返回其输出的数据与将入队的请求；不写入输出、不记录历史、不进入调度队列；
+// keyin非空时仅作为副本的自定义配置，params非nil时经SetParams校验后仅作为副本的参数，均不修改sp
+func Preview(sp *spider.Spider, ruleName, rawurl, keyin string, params map[string]interface{}, file string) *PreviewResult {
+	res := &PreviewResult{Spider: sp.GetName(), Rule: ruleName, Url: rawurl}
+	sp = sp.Copy()
+	if keyin != "" {
+		sp.SetKeyin(keyin)
+	}
+	if params != nil {
+		if res.Err = sp.SetParams(params); res.Err != nil {
+			return res
+		}
+	}
+	if _, ok := sp.GetRule(ruleName); !ok {
+		res.Err = fmt.Errorf("蜘蛛 %s 不存在规则 %s", sp.GetName(), ruleName)
+		return res
+	}
+	sp.CatchRequests(func(req *request.Request) {
+		res.Requests = append(res.Requests, req)
+	})
+
+	req := &request.Request{Url: rawurl, Rule: ruleName, Reloadable: true}
+	if err := req.SetSpiderName(sp.GetName()).SetEnableCookie(sp.GetEnableCookie()).Prepare(); err != nil {
+		res.Err = err
+		return res
+	}
+
+	var ctx *spider.Context
+	if file != "" {
+		ctx = spider.GetContext(sp, req)
+		resp, err := fileResponse(req, file)
+		ctx.SetResponse(resp).SetError(err)
+	} else {
+		ctx = downloader.SurferDownloader.Download(sp, req)
+	}
+	defer spider.PutContext(ctx)
+	if res.Err = ctx.GetError(); res.Err != nil {
+		return res
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				res.Err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		ctx.Parse(ruleName)
+	}()
+	res.Items = ctx.PullItems()
+	for _, f := range ctx.PullFiles() {
+		name, _ := f["Name"].(string)
+		res.Files = append(res.Files, name)
+	}
+	return res
+}
+
+// Print 以易读的格式输出预览结果
+func (self *PreviewResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "蜘蛛: %s  规则: %s\n链接: %s\n", self.Spider, self.Rule, self.Url)
+	if self.Err != nil {
+		fmt.Fprintf(w, "错误: %v\n", self.Err)
+	}
+	fmt.Fprintf(w, "\n数据 (%d):\n", len(self.Items))
+	for i, cell := range self.Items {
+		b, err := json.MarshalIndent(cell["Data"], "  ", "  ")
+		if err != nil {
+			b = []byte(fmt.Sprint(cell["Data"]))
+		}
+		fmt.Fprintf(w, "  [%d] %v %s\n", i, cell["RuleName"], b)
+	}
+	if len(self.Files) > 0 {
+		fmt.Fprintf(w, "\n文件 (%d):\n", len(self.Files))
+		for _, name := range self.Files {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+	fmt.Fprintf(w, "\n请求 (%d):\n", len(self.Requests))
+	for _, req := range self.Requests {
+		fmt.Fprintf(w, "  [%s] %s %s\n", req.GetRuleName(), req.GetMethod(), req.GetUrl())
+	}
+}
+
+func fileResponse(req *request.Request, file string) (*http.Response, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(req.GetUrl())
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		Request: &http.Request{
+			Method: req.GetMethod(),
+			URL:    u,
+			Host:   u.Host,
+			Header: req.GetHeader(),
+		},
+	}, nil
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-spider/spider"
+)
+
+// registerPreviewSpider 注册一个输出标题与自定义配置并跟随链接的蜘蛛
+func registerPreviewSpider(name string) *spider.Spider {
+	return spider.Spider{
+		Name:  name,
+		Keyin: "orig",
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{
+			"list": {ParseFunc: func(ctx *spider.Context) {
+				ctx.Output(map[string]interface{}{"title": ctx.GetDom().Find("h1").Text(), "keyin": ctx.GetKeyin()})
+				ctx.FollowLinks("", "detail")
+			}},
+		}},
+	}.Register()
+}
+
+func writePreviewFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "list.html")
+	ioutil.WriteFile(file, []byte(`<html><body><h1>Title</h1><a href="item/1">1</a></body></html>`), 0644)
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestPreview(t *testing.T) {
+	sp := registerPreviewSpider("preview_test")
+	defer spider.Species.Remove(sp.GetName())
+	file, clean := writePreviewFile(t)
+	defer clean()
+
+	res := Preview(sp, "list", "http://example.com/a/", "kw", nil, file)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(res.Items) != 1 {
+		t.Fatalf("got %d items", len(res.Items))
+	}
+	data := res.Items[0]["Data"].(map[string]interface{})
+	if data["title"] != "Title" || data["keyin"] != "kw" {
+		t.Errorf("got %v", data)
+	}
+	if len(res.Requests) != 1 || res.Requests[0].GetUrl() != "http://example.com/a/item/1" {
+		t.Errorf("got requests %v", res.Requests)
+	}
+	// 自定义配置只作用于副本
+	if sp.GetKeyin() != "orig" {
+		t.Errorf("shared spider keyin changed to %q", sp.GetKeyin())
+	}
+
+	if res := Preview(sp, "missing", "http://example.com/", "", nil, file); res.Err == nil {
+		t.Error("want error for missing rule")
+	}
+	if res := Preview(sp, "list", "http://example.com/", "", nil, file+".missing"); res.Err == nil {
+		t.Error("want error for missing file")
+	}
+}
+
+func TestPreviewParams(t *testing.T) {
+	sp := spider.Spider{
+		Name:   "preview_params_test",
+		Params: []*spider.Param{{SchemaField: spider.SchemaField{Name: "pages", Type: spider.FIELD_INT, Default: 5}}},
+		RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{
+			"list": {ParseFunc: func(ctx *spider.Context) {
+				ctx.Output(map[string]interface{}{"pages": ctx.GetParam("pages")})
+			}},
+		}},
+	}.Register()
+	defer spider.Species.Remove(sp.GetName())
+	file, clean := writePreviewFile(t)
+	defer clean()
+
+	res := Preview(sp, "list", "http://example.com/", "", map[string]interface{}{"pages": "2"}, file)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(res.Items) != 1 || res.Items[0]["Data"].(map[string]interface{})["pages"] != int64(2) {
+		t.Errorf("got %v", res.Items)
+	}
+	// 参数只作用于副本
+	if got := sp.GetParam("pages"); got != int64(5) {
+		t.Errorf("shared spider pages = %#v", got)
+	}
+	if res := Preview(sp, "list", "http://example.com/", "", map[string]interface{}{"page": 2}, file); res.Err == nil {
+		t.Error("want error for an undeclared param")
+	}
+}
@@ -1,6 +1,10 @@
 package crawler
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	. "go-spider/spider"
 	"go-spider/common/util"
 	"go-spider/logs"
@@ -13,13 +17,26 @@ type (
 		Add(*Spider)
 		AddAll([]*Spider)
 		AddKeyins(string) 
+		AddParams(map[string][]map[string]interface{}) error
+		AddChain(Chain) error
 		GetByIndex(int) *Spider
 		GetByName(string) *Spider
 		GetAll() []*Spider
 		Len() int 
 	}
 	sq struct {
-		list []*Spider
+		list   []*Spider
+		chains []Chain
+	}
+	// Chain 将上游蜘蛛输出数据的字段值作为下游蜘蛛的自定义配置或种子请求，须在AddKeyins之后声明
+	Chain struct {
+		From     string // 上游蜘蛛名，同名的全部蜘蛛均作为上游
+		FromRule string // 仅取上游该规则输出的数据，为空时不限
+		Field    string // 取值字段，值为数组时逐项传递
+		To       string // 下游蜘蛛名，同名的全部蜘蛛（如不同自定义配置的副本）均作为下游，各自接收全部取值
+		As       string // CHAIN_KEYIN（默认）或CHAIN_REQUEST
+		Rule     string // As为CHAIN_REQUEST时种子请求的规则
+		Buffer   int    // 缓冲数量，满时上游阻塞，0为ChainBuffer
 	}
 )
 
@@ -31,6 +48,7 @@ func NewSpiderQueue() SpiderQueue {
 
 func (self *sq) Reset() {
 	self.list = []*Spider{}
+	self.chains = nil
 }
 
 func (self *sq) Add(sp *Spider) {
@@ -82,6 +100,103 @@ func (self *sq) AddKeyins(keyins string) {
 	self.AddAll(unit1)
 }
 
+// AddParams 为声明了Params的蜘蛛按参数组（键为蜘蛛名）各生成一个副本，未提供参数组的取默认值；
+// 任一参数组校验失败（包括必填参数未提供）时返回错误
+func (self *sq) AddParams(sets map[string][]map[string]interface{}) error {
+	var errs []string
+	list := self.GetAll()
+	self.Reset()
+	for _, sp := range list {
+		if len(sp.Params) == 0 {
+			self.Add(sp)
+			continue
+		}
+		values := sets[sp.GetName()]
+		if len(values) == 0 {
+			values = []map[string]interface{}{nil}
+		}
+		for _, v := range values {
+			nsp := sp.Copy()
+			if err := nsp.SetParams(v); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			self.Add(nsp)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// AddChain 应用一条串联声明，并将上游蜘蛛排在下游之前，使并发数小于蜘蛛数时下游不会占满并发而等待未启动的上游；
+// 形成环的串联返回错误
+func (self *sq) AddChain(c Chain) error {
+	if self.reaches(c.To, c.From) {
+		return fmt.Errorf("串联 %s -> %s 形成环", c.From, c.To)
+	}
+	var tos []*Spider
+	for _, sp := range self.list {
+		if sp.GetName() == c.To {
+			tos = append(tos, sp)
+		}
+	}
+	if len(tos) == 0 {
+		return fmt.Errorf("串联的下游蜘蛛 %s 不在本批任务中", c.To)
+	}
+	var found bool
+	for _, sp := range self.list {
+		if sp.GetName() != c.From {
+			continue
+		}
+		found = true
+		for _, to := range tos {
+			if err := sp.ChainTo(to, c.FromRule, c.Field, c.As, c.Rule, c.Buffer); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("串联的上游蜘蛛 %s 不在本批任务中", c.From)
+	}
+	self.chains = append(self.chains, c)
+	self.sortByChain()
+	return nil
+}
+
+// reaches 返回已应用的串联中from能否到达to
+func (self *sq) reaches(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, c := range self.chains {
+		if c.From == from && self.reaches(c.To, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByChain 按串联的层级稳定排序并重设蜘蛛的id
+func (self *sq) sortByChain() {
+	depth := make(map[string]int)
+	// 串联无环，层级至多经len(chains)轮即可确定
+	for range self.chains {
+		for _, c := range self.chains {
+			if d := depth[c.From] + 1; d > depth[c.To] {
+				depth[c.To] = d
+			}
+		}
+	}
+	sort.SliceStable(self.list, func(i, j int) bool {
+		return depth[self.list[i].GetName()] < depth[self.list[j].GetName()]
+	})
+	for i, sp := range self.list {
+		sp.SetId(i)
+	}
+}
+
 func (self *sq) GetByIndex(idx int) *Spider {
 	return self.list[idx]
 }
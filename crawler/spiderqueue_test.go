@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"go-spider/spider"
+)
+
+func newParamSpider() *spider.Spider {
+	return &spider.Spider{Name: "shop", RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}}, Params: []*spider.Param{
+		{SchemaField: spider.SchemaField{Name: "city", Required: true}},
+		{SchemaField: spider.SchemaField{Name: "pages", Type: spider.FIELD_INT, Default: 5}},
+	}}
+}
+
+func TestAddParams(t *testing.T) {
+	q := NewSpiderQueue()
+	q.Add(newParamSpider())
+	q.Add(&spider.Spider{Name: "plain", RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}}})
+	err := q.AddParams(map[string][]map[string]interface{}{
+		"shop": {{"city": "beijing"}, {"city": "shanghai", "pages": "2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 3 {
+		t.Fatalf("got %d spiders, want 3", q.Len())
+	}
+	if got := q.GetByIndex(1).GetParam("pages"); got != int64(2) {
+		t.Errorf("pages = %#v", got)
+	}
+}
+
+func TestAddParamsRequired(t *testing.T) {
+	q := NewSpiderQueue()
+	q.Add(newParamSpider())
+	// 未提供参数组时必填参数缺失，须返回错误而非静默跳过
+	if err := q.AddParams(nil); err == nil || !strings.Contains(err.Error(), "city") {
+		t.Errorf("missing required param: %v", err)
+	}
+	q.Reset()
+	q.Add(newParamSpider())
+	if err := q.AddParams(map[string][]map[string]interface{}{"shop": {{"pages": 1}}}); err == nil {
+		t.Error("want error for a set without the required param")
+	}
+}
+
+func TestAddChainOrder(t *testing.T) {
+	q := NewSpiderQueue()
+	for _, name := range []string{"c", "b", "a", "x"} {
+		q.Add(&spider.Spider{Name: name, RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}}})
+	}
+	for _, c := range []Chain{{From: "b", To: "c", Field: "f"}, {From: "a", To: "b", Field: "f"}} {
+		if err := q.AddChain(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 上游排在下游之前，id与位置一致
+	var names []string
+	for i, sp := range q.GetAll() {
+		names = append(names, sp.GetName())
+		if sp.GetId() != i {
+			t.Errorf("%s id = %d, want %d", sp.GetName(), sp.GetId(), i)
+		}
+	}
+	if got := strings.Join(names, ","); got != "a,x,b,c" {
+		t.Errorf("order = %s", got)
+	}
+	if err := q.AddChain(Chain{From: "c", To: "a", Field: "f"}); err == nil {
+		t.Error("want error for a chain cycle")
+	}
+}
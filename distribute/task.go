@@ -1,18 +1,35 @@
 package distribute
 
-
 type Task struct {
 	Id             int
-	Spiders        []map[string]string 
-	ThreadNum      int                 
-	Pausetime      int64               
-	OutType        string              
-	DockerCap      int                 
-	DockerQueueCap int                 
-	SuccessInherit bool                
-	FailureInherit bool                
-	Limit          int64               
-	ProxyMinute    int64               
-	
-	Keyins string 
+	Spiders        []TaskSpider
+	ThreadNum      int
+	Pausetime      int64
+	OutType        string
+	DockerCap      int
+	DockerQueueCap int
+	SuccessInherit bool
+	FailureInherit bool
+	Limit          int64
+	ProxyMinute    int64
+	Proxies        []string
+	Chains         []TaskChain // 蜘蛛间的串联，声明时任务不拆分，以便上下游在同一节点运行
+}
+
+// TaskSpider 任务中的一个蜘蛛副本
+type TaskSpider struct {
+	Name   string
+	Keyin  string                 // 未声明Params的蜘蛛的自定义配置
+	Params map[string]interface{} // 已校验的参数值，由节点按蜘蛛声明再次校验
+}
+
+// TaskChain 任务中的一条串联声明，字段与crawler.Chain一致
+type TaskChain struct {
+	From     string
+	FromRule string
+	Field    string
+	To       string
+	As       string
+	Rule     string
+	Buffer   int
 }
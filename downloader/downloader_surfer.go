@@ -4,14 +4,23 @@ import (
 	"errors"
 	"net/http"
 	"net/http/cookiejar"
+	"sync"
 
 	"go-spider/downloader/request"
 	"go-spider/downloader/surfer"
+	"go-spider/scheduler"
 	"go-spider/spider"
 	"go-spider/config"
 )
 
 type Surfer struct {
+	surf     surfer.Surfer
+	phantom  surfer.Surfer
+	sessions map[string]*sessionSurfer // 固定代理IP的会话各自使用独立的Cookie
+	lock     sync.Mutex
+}
+
+type sessionSurfer struct {
 	surf    surfer.Surfer
 	phantom surfer.Surfer
 }
@@ -19,30 +28,72 @@ type Surfer struct {
 var (
 	cookieJar, _     = cookiejar.New(nil)
 	SurferDownloader = &Surfer{
-		surf:    surfer.New(cookieJar),
-		phantom: surfer.NewPhantom(config.PHANTOMJS, config.PHANTOMJS_TEMP, cookieJar),
+		surf:     surfer.New(cookieJar),
+		phantom:  surfer.NewPhantom(config.PHANTOMJS, config.PHANTOMJS_TEMP, cookieJar),
+		sessions: make(map[string]*sessionSurfer),
 	}
 )
 
+func init() {
+	scheduler.OnReleaseSession(SurferDownloader.releaseSession)
+}
+
 func (self *Surfer) Download(sp *spider.Spider, cReq *request.Request) *spider.Context {
 	ctx := spider.GetContext(sp, cReq)
 
-	var resp *http.Response
-	var err error
+	surf, phantom := self.forSession(cReq)
+	resp, err := mws.download(sp, cReq, func() (resp *http.Response, err error) {
+		switch cReq.GetDownloaderID() {
+		case request.SURF_ID:
+			resp, err = surf.Download(cReq)
 
-	switch cReq.GetDownloaderID() {
-	case request.SURF_ID:
-		resp, err = self.surf.Download(cReq)
+		case request.PHANTOM_ID:
+			resp, err = phantom.Download(cReq)
+		}
 
-	case request.PHANTOM_ID:
-		resp, err = self.phantom.Download(cReq)
-	}
-
-	if resp.StatusCode >= 400 {
-		err = errors.New("响应状态 " + resp.Status)
-	}
+		if err == nil && resp != nil && resp.StatusCode >= 400 {
+			err = errors.New("响应状态 " + resp.Status)
+		}
+		return
+	})
 
 	ctx.SetResponse(resp).SetError(err)
 
 	return ctx
 }
+
+// EnablePhantomPool 设置PhantomJS常驻进程数，于下一次PhantomJS下载时生效，各代理会话共用；size不大于0时关闭
+func (self *Surfer) EnablePhantomPool(size int) {
+	if p, ok := self.phantom.(*surfer.Phantom); ok {
+		p.EnablePool(size)
+	}
+}
+
+// forSession 返回请求所属代理会话的下载器，会话更换代理IP后Cookie随之清空
+func (self *Surfer) forSession(req *request.Request) (surfer.Surfer, surfer.Surfer) {
+	session := req.GetProxySession()
+	if session == "" {
+		return self.surf, self.phantom
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	s, ok := self.sessions[session]
+	if !ok || req.IsSessionRenewed() {
+		jar, _ := cookiejar.New(nil)
+		s = &sessionSurfer{surf: surfer.New(jar), phantom: self.phantom}
+		if p, ok := self.phantom.(*surfer.Phantom); ok {
+			pcopy := *p
+			pcopy.CookieJar = jar
+			s.phantom = &pcopy
+		}
+		self.sessions[session] = s
+	}
+	return s.surf, s.phantom
+}
+
+// releaseSession 蜘蛛结束时丢弃其代理会话的下载器
+func (self *Surfer) releaseSession(session string) {
+	self.lock.Lock()
+	delete(self.sessions, session)
+	self.lock.Unlock()
+}
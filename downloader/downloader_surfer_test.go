@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/downloader/surfer"
+	"go-spider/spider"
+)
+
+// TestFakePhantomWorker 并非测试，而是供假phantomjs脚本启动的常驻worker，回显任务的链接
+func TestFakePhantomWorker(t *testing.T) {
+	if args := flag.Args(); len(args) == 0 || args[0] != "fake-phantom-worker" {
+		return
+	}
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		job := &surfer.PhantomJob{}
+		json.Unmarshal(in.Bytes(), job)
+		b, _ := json.Marshal(&surfer.Response{Body: job.Url})
+		os.Stdout.Write(append(b, '\n'))
+	}
+	// 测试期间不允许os.Exit(0)
+	os.Exit(2)
+}
+
+func TestSurferPhantomPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phantom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 假phantomjs忽略脚本参数，只能以常驻模式从stdin读取任务，单次启动时没有输出
+	script := filepath.Join(dir, "phantomjs")
+	ioutil.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\nexec %q -test.run='^TestFakePhantomWorker$' -- fake-phantom-worker\n", os.Args[0])), 0755)
+
+	p := SurferDownloader.phantom.(*surfer.Phantom)
+	bin := p.PhantomjsFile
+	p.PhantomjsFile = script
+	defer func() { p.PhantomjsFile = bin }()
+	SurferDownloader.EnablePhantomPool(1)
+	defer SurferDownloader.EnablePhantomPool(0)
+
+	sp := &spider.Spider{Name: "phantom_pool_test", RuleTree: &spider.RuleTree{Trunk: map[string]*spider.Rule{}}}
+	for _, session := range []string{"", "s"} {
+		req := &request.Request{Url: "http://example.com/", Rule: "r", DownloaderID: request.PHANTOM_ID, TryTimes: 1, ProxySession: session}
+		req.Prepare()
+		ctx := SurferDownloader.Download(sp, req)
+		body, _ := ioutil.ReadAll(ctx.Response.Body)
+		if ctx.Response.StatusCode != 200 || string(body) != "http://example.com/" {
+			t.Errorf("session %q: status %d, body %q", session, ctx.Response.StatusCode, body)
+		}
+		spider.PutContext(ctx)
+	}
+}
+
+func TestSurferReleaseSession(t *testing.T) {
+	s := &Surfer{surf: surfer.New(), phantom: surfer.New(), sessions: make(map[string]*sessionSurfer)}
+	req := &request.Request{Url: "http://example.com/", Rule: "r", ProxySession: "s"}
+	req.Prepare()
+	first, _ := s.forSession(req)
+	if again, _ := s.forSession(req); again != first {
+		t.Error("session surfer not reused")
+	}
+	s.releaseSession("s")
+	if len(s.sessions) != 0 {
+		t.Fatalf("sessions = %v", s.sessions)
+	}
+	if again, _ := s.forSession(req); again == first {
+		t.Error("released session reused its cookies")
+	}
+}
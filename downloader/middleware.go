@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"net/http"
+	"sync"
+
+	"go-spider/downloader/request"
+	"go-spider/spider"
+)
+
+type (
+	// Middleware 下载中间件
+	// BeforeRequest 返回非nil的响应时跳过实际下载（如命中缓存），返回错误时终止下载；
+	// AfterResponse 可替换响应，或返回错误将其判为失败（如识别出封禁页）；
+	// OnError 返回非nil的响应时视为已恢复。
+	Middleware interface {
+		BeforeRequest(sp *spider.Spider, req *request.Request) (*http.Response, error)
+		AfterResponse(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error)
+		OnError(sp *spider.Spider, req *request.Request, err error) (*http.Response, error)
+	}
+
+	// MiddlewareFunc 便于只实现部分钩子的中间件，未设置的钩子原样放行
+	MiddlewareFunc struct {
+		Before func(sp *spider.Spider, req *request.Request) (*http.Response, error)
+		After  func(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error)
+		Error  func(sp *spider.Spider, req *request.Request, err error) (*http.Response, error)
+	}
+
+	middlewares struct {
+		global    []Middleware
+		perSpider map[string][]Middleware
+		sync.RWMutex
+	}
+)
+
+var mws = &middlewares{
+	perSpider: make(map[string][]Middleware),
+}
+
+// Use 注册全局中间件，按注册顺序执行BeforeRequest，逆序执行AfterResponse与OnError
+func Use(m ...Middleware) {
+	mws.Lock()
+	mws.global = append(mws.global, m...)
+	mws.Unlock()
+}
+
+// UseFor 为指定名称的蜘蛛注册中间件，排在全局中间件之后
+func UseFor(spiderName string, m ...Middleware) {
+	mws.Lock()
+	mws.perSpider[spiderName] = append(mws.perSpider[spiderName], m...)
+	mws.Unlock()
+}
+
+func (self *middlewares) chain(spiderName string) []Middleware {
+	self.RLock()
+	defer self.RUnlock()
+	sp := self.perSpider[spiderName]
+	if len(self.global) == 0 && len(sp) == 0 {
+		return nil
+	}
+	chain := make([]Middleware, 0, len(self.global)+len(sp))
+	chain = append(chain, self.global...)
+	return append(chain, sp...)
+}
+
+func (self *middlewares) download(sp *spider.Spider, req *request.Request, fetch func() (*http.Response, error)) (resp *http.Response, err error) {
+	chain := self.chain(sp.GetName())
+	if len(chain) == 0 {
+		return fetch()
+	}
+
+	var i int
+	for ; i < len(chain); i++ {
+		resp, err = chain[i].BeforeRequest(sp, req)
+		if resp != nil || err != nil {
+			break
+		}
+	}
+	if i == len(chain) {
+		resp, err = fetch()
+	}
+
+	// 从发起响应的中间件的上一个开始逆序执行，不再回到其自身
+	for i--; i >= 0; i-- {
+		if err != nil {
+			r, e := chain[i].OnError(sp, req, err)
+			if r != nil {
+				closeBody(resp, r)
+				resp, err = r, nil
+			} else if e != nil {
+				err = e
+			}
+			continue
+		}
+		r, e := chain[i].AfterResponse(sp, req, resp)
+		closeBody(resp, r)
+		resp, err = r, e
+	}
+	return
+}
+
+// closeBody 响应被替换时关闭旧响应的Body
+func closeBody(old, cur *http.Response) {
+	if old != nil && old != cur && old.Body != nil && (cur == nil || cur.Body != old.Body) {
+		old.Body.Close()
+	}
+}
+
+func (self MiddlewareFunc) BeforeRequest(sp *spider.Spider, req *request.Request) (*http.Response, error) {
+	if self.Before == nil {
+		return nil, nil
+	}
+	return self.Before(sp, req)
+}
+
+func (self MiddlewareFunc) AfterResponse(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error) {
+	if self.After == nil {
+		return resp, nil
+	}
+	return self.After(sp, req, resp)
+}
+
+func (self MiddlewareFunc) OnError(sp *spider.Spider, req *request.Request, err error) (*http.Response, error) {
+	if self.Error == nil {
+		return nil, err
+	}
+	return self.Error(sp, req, err)
+}
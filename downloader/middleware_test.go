@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/spider"
+)
+
+type trackBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (self *trackBody) Close() error {
+	self.closed = true
+	return nil
+}
+
+func newResp(body *trackBody) *http.Response {
+	return &http.Response{StatusCode: 200, Body: body}
+}
+
+func recorder(name string, log *[]string) MiddlewareFunc {
+	return MiddlewareFunc{
+		Before: func(sp *spider.Spider, req *request.Request) (*http.Response, error) {
+			*log = append(*log, "before "+name)
+			return nil, nil
+		},
+		After: func(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error) {
+			*log = append(*log, "after "+name)
+			return resp, nil
+		},
+		Error: func(sp *spider.Spider, req *request.Request, err error) (*http.Response, error) {
+			*log = append(*log, "error "+name)
+			return nil, err
+		},
+	}
+}
+
+func testChain(m ...Middleware) *middlewares {
+	return &middlewares{global: m, perSpider: make(map[string][]Middleware)}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var log []string
+	sp := &spider.Spider{Name: "mw"}
+	mw := testChain(recorder("a", &log), recorder("b", &log))
+	mw.perSpider["mw"] = []Middleware{recorder("c", &log)}
+
+	resp, err := mw.download(sp, &request.Request{}, func() (*http.Response, error) {
+		log = append(log, "fetch")
+		return newResp(&trackBody{Reader: strings.NewReader("ok")}), nil
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+	want := []string{"before a", "before b", "before c", "fetch", "after c", "after b", "after a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got %v, want %v", log, want)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	var log []string
+	sp := &spider.Spider{Name: "mw"}
+	cached := newResp(&trackBody{Reader: strings.NewReader("cached")})
+	cache := MiddlewareFunc{
+		Before: func(sp *spider.Spider, req *request.Request) (*http.Response, error) {
+			log = append(log, "before cache")
+			return cached, nil
+		},
+		After: func(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error) {
+			log = append(log, "after cache")
+			return resp, nil
+		},
+	}
+	mw := testChain(recorder("a", &log), cache, recorder("b", &log))
+
+	resp, err := mw.download(sp, &request.Request{}, func() (*http.Response, error) {
+		t.Fatal("fetch should be skipped")
+		return nil, nil
+	})
+	if err != nil || resp != cached {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+	want := []string{"before a", "before cache", "after a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got %v, want %v", log, want)
+	}
+}
+
+func TestMiddlewareRecover(t *testing.T) {
+	var log []string
+	sp := &spider.Spider{Name: "mw"}
+	recovered := newResp(&trackBody{Reader: strings.NewReader("fallback")})
+	fallback := MiddlewareFunc{
+		Error: func(sp *spider.Spider, req *request.Request, err error) (*http.Response, error) {
+			log = append(log, "error fallback")
+			return recovered, nil
+		},
+	}
+	mw := testChain(recorder("a", &log), fallback, recorder("b", &log))
+
+	resp, err := mw.download(sp, &request.Request{}, func() (*http.Response, error) {
+		return nil, errors.New("timeout")
+	})
+	if err != nil || resp != recovered {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+	want := []string{"before a", "before b", "error b", "error fallback", "after a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got %v, want %v", log, want)
+	}
+}
+
+func TestMiddlewareReplaceClosesBody(t *testing.T) {
+	sp := &spider.Spider{Name: "mw"}
+	orig := &trackBody{Reader: strings.NewReader("orig")}
+	replace := MiddlewareFunc{
+		After: func(sp *spider.Spider, req *request.Request, resp *http.Response) (*http.Response, error) {
+			return newResp(&trackBody{Reader: strings.NewReader("new")}), nil
+		},
+	}
+	resp, err := testChain(replace).download(sp, &request.Request{}, func() (*http.Response, error) {
+		return newResp(orig), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !orig.closed {
+		t.Error("replaced body not closed")
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "new" {
+		t.Errorf("body = %q", b)
+	}
+}
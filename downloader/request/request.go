@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"go-spider/common/util"
+	"go-spider/downloader/surfer"
 )
 
 
@@ -22,6 +24,9 @@ type Request struct {
 	Header        http.Header     
 	EnableCookie  bool            
 	PostData      string          
+	PostJson      interface{}     
+	PostBytes     []byte          
+	PostFiles     []surfer.PostFile 
 	DialTimeout   time.Duration   
 	ConnTimeout   time.Duration   
 	TryTimes      int             
@@ -31,10 +36,13 @@ type Request struct {
 	TempIsJson    map[string]bool 
 	Priority      int             
 	Reloadable    bool            
+	Profile       string          
+	ProxySession  string          // 非空时同一会话的请求固定使用同一代理IP
 	
 	
 	
 	DownloaderID int
+	SessionRenewed bool // 会话绑定的代理IP失效后，本请求已换用新的代理IP
 
 	proxy  string 
 	unique string 
@@ -138,10 +146,29 @@ func (self *Request) Serialize() string {
 }
 
 
+// KEYIN_TEMP 蜘蛛串联时派生的请求在Temp中记录所属的自定义配置，不同配置下的相同请求不去重
+const KEYIN_TEMP = "__keyin__"
+
 func (self *Request) Unique() string {
 	if self.unique == "" {
-		block := md5.Sum([]byte(self.Spider + self.Rule + self.Url + self.Method))
-		self.unique = hex.EncodeToString(block[:])
+		h := md5.New()
+		h.Write([]byte(self.Spider + self.Rule + self.Url + self.Method))
+		// 请求体不同的请求不应被去重
+		if self.PostJson != nil {
+			b, _ := json.Marshal(self.PostJson)
+			h.Write(b)
+		} else if self.PostBytes != nil {
+			h.Write(self.PostBytes)
+		}
+		h.Write([]byte(self.PostData))
+		for _, f := range self.PostFiles {
+			fmt.Fprintf(h, "\x00%s\x00%s\x00%s\x00", f.Field, f.Name, f.ContentType)
+			h.Write(f.Data)
+		}
+		if keyin, _ := self.GetTemp(KEYIN_TEMP, "").(string); keyin != "" {
+			fmt.Fprintf(h, "\x00keyin\x00%s", keyin)
+		}
+		self.unique = hex.EncodeToString(h.Sum(nil))
 	}
 	return self.unique
 }
@@ -188,6 +215,38 @@ func (self *Request) GetPostData() string {
 	return self.PostData
 }
 
+func (self *Request) GetPostJson() interface{} {
+	return self.PostJson
+}
+
+func (self *Request) SetPostJson(v interface{}) *Request {
+	self.PostJson = v
+	return self
+}
+
+func (self *Request) GetPostBytes() []byte {
+	return self.PostBytes
+}
+
+func (self *Request) SetPostBytes(b []byte) *Request {
+	self.PostBytes = b
+	return self
+}
+
+func (self *Request) GetPostFiles() []surfer.PostFile {
+	return self.PostFiles
+}
+
+func (self *Request) AddPostFile(field, name, contentType string, data []byte) *Request {
+	self.PostFiles = append(self.PostFiles, surfer.PostFile{
+		Field:       field,
+		Name:        name,
+		ContentType: contentType,
+		Data:        data,
+	})
+	return self
+}
+
 func (self *Request) GetHeader() http.Header {
 	return self.Header
 }
@@ -325,6 +384,34 @@ func (self *Request) SetPriority(priority int) *Request {
 	return self
 }
 
+func (self *Request) GetProfile() string {
+	return self.Profile
+}
+
+func (self *Request) SetProfile(profile string) *Request {
+	self.Profile = profile
+	return self
+}
+
+func (self *Request) GetProxySession() string {
+	return self.ProxySession
+}
+
+func (self *Request) SetProxySession(key string) *Request {
+	self.ProxySession = key
+	return self
+}
+
+// IsSessionRenewed 会话绑定的代理IP失效后，本请求是否已换用新的代理IP（需重新建立会话）
+func (self *Request) IsSessionRenewed() bool {
+	return self.SessionRenewed
+}
+
+func (self *Request) SetSessionRenewed(renewed bool) *Request {
+	self.SessionRenewed = renewed
+	return self
+}
+
 func (self *Request) GetDownloaderID() int {
 	return self.DownloaderID
 }
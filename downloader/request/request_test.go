@@ -57,3 +57,50 @@ func TestReqTemp(t *testing.T) {
 type x struct {
 	Name string
 }
+
+func TestUniqueBody(t *testing.T) {
+	newReq := func() *Request {
+		return &Request{Spider: "s", Rule: "r", Url: "http://example.com/", Method: "POST"}
+	}
+	a, b := newReq(), newReq()
+	if a.Unique() != b.Unique() {
+		t.Fatal("identical requests differ")
+	}
+
+	a, b = newReq(), newReq()
+	a.PostData, b.PostData = "q=1", "q=2"
+	if a.Unique() == b.Unique() {
+		t.Error("PostData ignored")
+	}
+
+	a, b = newReq(), newReq()
+	a.AddPostFile("file", "a.txt", "text/plain", []byte("a"))
+	b.AddPostFile("file", "a.txt", "text/plain", []byte("b"))
+	if a.Unique() == b.Unique() {
+		t.Error("PostFiles ignored")
+	}
+
+	a, b = newReq(), newReq()
+	a.Temp, b.Temp = Temp{KEYIN_TEMP: "k1"}, Temp{KEYIN_TEMP: "k2"}
+	if a.Unique() == b.Unique() {
+		t.Error("chained keyin ignored")
+	}
+	a, b = newReq(), newReq()
+	a.Temp = Temp{"other": "x"}
+	if a.Unique() != b.Unique() {
+		t.Error("unrelated Temp changed Unique")
+	}
+}
+
+func TestSessionRenewedSerialize(t *testing.T) {
+	req := &Request{Url: "http://example.com/", Rule: "r", ProxySession: "s"}
+	req.Prepare()
+	req.SetSessionRenewed(true)
+	got, err := UnSerialize(req.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsSessionRenewed() || !req.Copy().IsSessionRenewed() {
+		t.Error("SessionRenewed lost on serialization")
+	}
+}
@@ -0,0 +1,279 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Profile 浏览器指纹，包含一组相互一致的请求头及其发送顺序
+	Profile struct {
+		Name    string
+		Browser string
+		Headers []Header
+	}
+	// Header 值为空时仅用于占位排序（如Host、Cookie、Referer）
+	Header struct {
+		Name  string
+		Value string
+	}
+)
+
+// ProfileFile 浏览器指纹数据文件，存在时于启动时加载，可覆盖同名内置指纹
+var ProfileFile = "./browser_profiles.json"
+
+var (
+	profiles    = map[string]*Profile{}
+	profileList []*Profile
+	profileLock sync.RWMutex
+	profileRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+var defaultProfiles = []*Profile{
+	{
+		Name:    "chrome-windows",
+		Browser: "chrome",
+		Headers: []Header{
+			{"Host", ""},
+			{"Connection", ""},
+			{"Content-Length", ""},
+			{"sec-ch-ua", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Content-Type", ""},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Referer", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8"},
+			{"Cookie", ""},
+		},
+	},
+	{
+		Name:    "chrome-mac",
+		Browser: "chrome",
+		Headers: []Header{
+			{"Host", ""},
+			{"Connection", ""},
+			{"Content-Length", ""},
+			{"sec-ch-ua", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"macOS"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Content-Type", ""},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Referer", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8"},
+			{"Cookie", ""},
+		},
+	},
+	{
+		Name:    "edge-windows",
+		Browser: "edge",
+		Headers: []Header{
+			{"Host", ""},
+			{"Connection", ""},
+			{"Content-Length", ""},
+			{"sec-ch-ua", `"Not_A Brand";v="8", "Chromium";v="120", "Microsoft Edge";v="120"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Content-Type", ""},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Referer", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8,en-GB;q=0.7,en-US;q=0.6"},
+			{"Cookie", ""},
+		},
+	},
+	{
+		Name:    "firefox-windows",
+		Browser: "firefox",
+		Headers: []Header{
+			{"Host", ""},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2"},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Content-Type", ""},
+			{"Content-Length", ""},
+			{"Referer", ""},
+			{"Connection", ""},
+			{"Cookie", ""},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	},
+	{
+		Name:    "safari-mac",
+		Browser: "safari",
+		Headers: []Header{
+			{"Host", ""},
+			{"Content-Type", ""},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Cookie", ""},
+			{"Sec-Fetch-Dest", "document"},
+			{"Content-Length", ""},
+			{"Accept-Language", "zh-CN,zh-Hans;q=0.9"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15"},
+			{"Referer", ""},
+			{"Accept-Encoding", "gzip, deflate"},
+			{"Connection", ""},
+		},
+	},
+}
+
+func init() {
+	for _, p := range defaultProfiles {
+		AddProfile(p)
+	}
+	if _, err := os.Stat(ProfileFile); err == nil {
+		if _, err := LoadProfiles(ProfileFile); err != nil {
+			log.Printf("[E] Surfer: 浏览器指纹文件[%s]: %v\n", ProfileFile, err)
+		}
+	}
+}
+
+// AddProfile 添加或替换同名指纹
+func AddProfile(p *Profile) {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	if _, ok := profiles[p.Name]; ok {
+		for i, old := range profileList {
+			if old.Name == p.Name {
+				profileList[i] = p
+				break
+			}
+		}
+	} else {
+		profileList = append(profileList, p)
+	}
+	profiles[p.Name] = p
+}
+
+// LoadProfiles 从JSON数据文件加载指纹列表，返回加载数量
+func LoadProfiles(filename string) (int, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	var ps []*Profile
+	if err = json.Unmarshal(b, &ps); err != nil {
+		return 0, err
+	}
+	var n int
+	for _, p := range ps {
+		if p.Name == "" || p.UserAgent() == "" {
+			continue
+		}
+		AddProfile(p)
+		n++
+	}
+	return n, nil
+}
+
+func GetProfile(name string) (*Profile, bool) {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// RandomProfile 随机返回一个指纹，except为需要避开的指纹名
+func RandomProfile(except ...string) *Profile {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	l := len(profileList)
+	if l == 0 {
+		return nil
+	}
+	p := profileList[profileRand.Intn(l)]
+	if l > 1 && len(except) > 0 && p.Name == except[0] {
+		p = profileList[(indexOf(profileList, p)+1+profileRand.Intn(l-1))%l]
+	}
+	return p
+}
+
+func ProfileNames() []string {
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	names := make([]string, len(profileList))
+	for i, p := range profileList {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func (self *Profile) UserAgent() string {
+	for _, h := range self.Headers {
+		if strings.EqualFold(h.Name, "User-Agent") {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Apply 将指纹请求头写入header，已存在的请求头不会被覆盖，返回实际写入的键
+// 键名按指纹原样写入（如小写的sec-ch-ua），以保持与真实浏览器一致
+func (self *Profile) Apply(header http.Header) (keys []string) {
+	for _, h := range self.Headers {
+		if h.Value == "" {
+			continue
+		}
+		if _, ok := header[http.CanonicalHeaderKey(h.Name)]; ok {
+			continue
+		}
+		if _, ok := header[h.Name]; ok {
+			continue
+		}
+		header[h.Name] = []string{h.Value}
+		keys = append(keys, h.Name)
+	}
+	return
+}
+
+// Order 返回请求头的发送顺序
+func (self *Profile) Order() []string {
+	order := make([]string, len(self.Headers))
+	for i, h := range self.Headers {
+		order[i] = h.Name
+	}
+	return order
+}
+
+func indexOf(list []*Profile, p *Profile) int {
+	for i, v := range list {
+		if v == p {
+			return i
+		}
+	}
+	return 0
+}
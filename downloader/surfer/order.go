@@ -0,0 +1,74 @@
+package surfer
+
+import (
+	"bytes"
+	"net"
+	"net/textproto"
+	"sort"
+)
+
+const maxHeadSize = 64 << 10
+
+// orderedConn 按浏览器指纹的顺序重排请求头后写出
+type orderedConn struct {
+	net.Conn
+	rank map[string]int
+	head []byte
+	done bool
+}
+
+func newOrderedConn(c net.Conn, order []string) net.Conn {
+	if len(order) == 0 {
+		return c
+	}
+	rank := make(map[string]int, len(order))
+	for i, k := range order {
+		rank[textproto.CanonicalMIMEHeaderKey(k)] = i
+	}
+	return &orderedConn{Conn: c, rank: rank}
+}
+
+func (self *orderedConn) Write(p []byte) (int, error) {
+	if self.done {
+		return self.Conn.Write(p)
+	}
+	self.head = append(self.head, p...)
+	idx := bytes.Index(self.head, []byte("\r\n\r\n"))
+	if idx < 0 {
+		if len(self.head) > maxHeadSize {
+			self.done = true
+			_, err := self.Conn.Write(self.head)
+			self.head = nil
+			return len(p), err
+		}
+		return len(p), nil
+	}
+	self.done = true
+	buf := self.reorder(self.head[:idx])
+	buf = append(buf, self.head[idx:]...)
+	self.head = nil
+	if _, err := self.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (self *orderedConn) reorder(head []byte) []byte {
+	lines := bytes.Split(head, []byte("\r\n"))
+	fields := lines[1:]
+	sort.SliceStable(fields, func(i, j int) bool {
+		return self.rankOf(fields[i]) < self.rankOf(fields[j])
+	})
+	return bytes.Join(lines, []byte("\r\n"))
+}
+
+func (self *orderedConn) rankOf(line []byte) int {
+	i := bytes.IndexByte(line, ':')
+	if i < 0 {
+		return len(self.rank)
+	}
+	if r, ok := self.rank[textproto.CanonicalMIMEHeaderKey(string(line[:i]))]; ok {
+		return r
+	}
+	return len(self.rank)
+}
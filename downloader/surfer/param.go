@@ -2,11 +2,14 @@ package surfer
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"time"
@@ -17,7 +20,7 @@ type Param struct {
 	method        string
 	url           *url.URL
 	proxy         *url.URL
-	body          io.Reader
+	body          []byte // 每次尝试时重新生成Reader
 	header        http.Header
 	enableCookie  bool
 	dialTimeout   time.Duration
@@ -25,6 +28,8 @@ type Param struct {
 	tryTimes      int
 	retryPause    time.Duration
 	redirectTimes int
+	profile       *agent.Profile
+	profileKeys   []string
 	client        *http.Client
 }
 
@@ -41,34 +46,21 @@ func NewParam(req Request) (param *Param, err error) {
 		}
 	}
 
-	param.header = req.GetHeader()
-	if param.header == nil {
-		param.header = make(http.Header)
+	param.header = make(http.Header)
+	for k, v := range req.GetHeader() {
+		param.header[k] = append([]string(nil), v...)
 	}
 
-	switch method := strings.ToUpper(req.GetMethod()); method {
+	method := strings.ToUpper(req.GetMethod())
+	multi := strings.HasSuffix(method, "-M")
+	switch method = strings.TrimSuffix(method, "-M"); method {
 	case "GET", "HEAD":
 		param.method = method
-	case "POST":
+	case "POST", "PUT", "PATCH", "DELETE":
 		param.method = method
-		param.header.Add("Content-Type", "application/x-www-form-urlencoded")
-		param.body = strings.NewReader(req.GetPostData())
-	case "POST-M":
-		param.method = "POST"
-		body := &bytes.Buffer{}
-		writer := multipart.NewWriter(body)
-		values, _ := url.ParseQuery(req.GetPostData())
-		for k, vs := range values {
-			for _, v := range vs {
-				writer.WriteField(k, v)
-			}
-		}
-		err := writer.Close()
-		if err != nil {
+		if err = param.setBody(req, multi); err != nil {
 			return nil, err
 		}
-		param.header.Add("Content-Type", writer.FormDataContentType())
-		param.body = body
 
 	default:
 		param.method = "GET"
@@ -76,7 +68,13 @@ func NewParam(req Request) (param *Param, err error) {
 
 	param.enableCookie = req.GetEnableCookie()
 
-	if len(param.header.Get("User-Agent")) == 0 {
+	if names := req.GetProfile(); names != "" {
+		if param.enableCookie {
+			names = strings.Split(names, ",")[0]
+		}
+		param.setProfile(pickProfile(names, ""))
+	}
+	if param.profile == nil && len(param.header.Get("User-Agent")) == 0 {
 		if param.enableCookie {
 			param.header.Add("User-Agent", agent.UserAgents["common"][0])
 		} else {
@@ -99,6 +97,83 @@ func NewParam(req Request) (param *Param, err error) {
 }
 
 
+// 请求体优先级：JSON > 原始字节 > multipart（含文件或方法带-M后缀） > urlencoded表单
+func (self *Param) setBody(req Request, multi bool) error {
+	switch {
+	case req.GetPostJson() != nil:
+		b, err := json.Marshal(req.GetPostJson())
+		if err != nil {
+			return err
+		}
+		self.header.Set("Content-Type", "application/json; charset=utf-8")
+		self.body = b
+
+	case req.GetPostBytes() != nil:
+		if self.header.Get("Content-Type") == "" {
+			self.header.Set("Content-Type", "application/octet-stream")
+		}
+		self.body = req.GetPostBytes()
+
+	case multi || len(req.GetPostFiles()) > 0:
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		values, _ := url.ParseQuery(req.GetPostData())
+		for k, vs := range values {
+			for _, v := range vs {
+				writer.WriteField(k, v)
+			}
+		}
+		for _, f := range req.GetPostFiles() {
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(f.Field), escapeQuotes(f.Name)))
+			if f.ContentType != "" {
+				h.Set("Content-Type", f.ContentType)
+			} else {
+				h.Set("Content-Type", "application/octet-stream")
+			}
+			part, err := writer.CreatePart(h)
+			if err != nil {
+				return err
+			}
+			if _, err = part.Write(f.Data); err != nil {
+				return err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		self.header.Set("Content-Type", writer.FormDataContentType())
+		self.body = body.Bytes()
+
+	case self.method == "POST" || req.GetPostData() != "":
+		self.header.Add("Content-Type", "application/x-www-form-urlencoded")
+		self.body = []byte(req.GetPostData())
+	}
+	return nil
+}
+
+// bodyReader 返回新的请求体Reader，无请求体时返回nil
+func (self *Param) bodyReader() io.Reader {
+	if self.body == nil {
+		return nil
+	}
+	return bytes.NewReader(self.body)
+}
+
+// resetBody 重试时请求体已被读取，需重新设置
+func (self *Param) resetBody(req *http.Request) {
+	if self.body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(self.body))
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+
 func (self *Param) writeback(resp *http.Response) *http.Response {
 	if resp == nil {
 		resp = new(http.Response)
@@ -133,3 +208,50 @@ func (self *Param) checkRedirect(req *http.Request, via []*http.Request) error {
 	}
 	return nil
 }
+
+func (self *Param) setProfile(p *agent.Profile) {
+	if p == nil {
+		return
+	}
+	for _, k := range self.profileKeys {
+		delete(self.header, k)
+	}
+	self.profile = p
+	self.profileKeys = p.Apply(self.header)
+}
+
+// 重试时更换指纹，启用了Cookie时保持不变
+func (self *Param) rotateProfile(req Request) {
+	if self.profile == nil || self.enableCookie {
+		return
+	}
+	if names := req.GetProfile(); names != "" {
+		self.setProfile(pickProfile(names, self.profile.Name))
+		return
+	}
+	self.setProfile(agent.RandomProfile(self.profile.Name))
+}
+
+// 从逗号分隔的指纹名中随机选取一个，尽量避开except
+func pickProfile(names, except string) *agent.Profile {
+	var list []*agent.Profile
+	for _, name := range strings.Split(names, ",") {
+		if p, ok := agent.GetProfile(strings.TrimSpace(name)); ok && p.Name != except {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		if p, ok := agent.GetProfile(except); ok {
+			return p
+		}
+		return nil
+	}
+	return list[rand.Intn(len(list))]
+}
+
+func (self *Param) headerOrder() []string {
+	if self.profile == nil {
+		return nil
+	}
+	return self.profile.Order()
+}
@@ -2,6 +2,7 @@ package surfer
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +26,15 @@ type (
 		TempJsDir     string            
 		jsFileMap     map[string]string 
 		CookieJar     *cookiejar.Jar
+		Pool          *PhantomPool // 非nil时直接使用，否则按EnablePool或PhantomPoolSize在下载时创建
+		pooling       *phantomPooling
+	}
+	// phantomPooling 按需创建的进程池，由各会话的副本共享
+	phantomPooling struct {
+		set  bool // 是否调用过EnablePool，否则取PhantomPoolSize
+		size int
+		pool *PhantomPool
+		sync.Mutex
 	}
 	
 	Response struct {
@@ -50,6 +61,7 @@ func NewPhantom(phantomjsFile, tempJsDir string, jar ...*cookiejar.Jar) Surfer {
 		PhantomjsFile: phantomjsFile,
 		TempJsDir:     tempJsDir,
 		jsFileMap:     make(map[string]string),
+		pooling:       &phantomPooling{},
 	}
 	if len(jar) != 0 {
 		phantom.CookieJar = jar[0]
@@ -69,13 +81,57 @@ func NewPhantom(phantomjsFile, tempJsDir string, jar ...*cookiejar.Jar) Surfer {
 		return phantom
 	}
 	phantom.createJsFile("js", js)
+	phantom.createJsFile("worker", jsWorker)
 	return phantom
 }
 
+// PhantomPoolSize 常驻phantomjs进程数，默认为0即每个请求单独启动进程；大于0时启用进程池。
+// 在首次下载时读取，之后的修改需通过EnablePool生效
+var PhantomPoolSize = 0
+
+// EnablePool 设置常驻phantomjs进程数，进程池在下一次下载时创建；size不大于0时关闭进程池，每个请求单独启动进程
+func (self *Phantom) EnablePool(size int) {
+	if self.pooling == nil {
+		self.pooling = &phantomPooling{}
+	}
+	p := self.pooling
+	p.Lock()
+	defer p.Unlock()
+	p.set, p.size = true, size
+	if p.pool != nil && p.pool.Size != size {
+		p.pool.Close()
+		p.pool = nil
+	}
+}
+
+// pool 返回下载使用的进程池，未启用时为nil
+func (self *Phantom) pool() *PhantomPool {
+	if self.Pool != nil || self.pooling == nil {
+		return self.Pool
+	}
+	p := self.pooling
+	p.Lock()
+	defer p.Unlock()
+	size := PhantomPoolSize
+	if p.set {
+		size = p.size
+	}
+	if size <= 0 {
+		return nil
+	}
+	if p.pool == nil {
+		p.pool = NewPhantomPool(self.PhantomjsFile, []string{self.jsFileMap["worker"]}, size)
+	}
+	return p.pool
+}
+
 
 func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
-	var encoding = "utf-8"
-	if _, params, err := mime.ParseMediaType(req.GetHeader().Get("Content-Type")); err == nil {
+	var (
+		encoding = "utf-8"
+		hint     = req.GetHeader().Get("Content-Type")
+	)
+	if _, params, err := mime.ParseMediaType(hint); err == nil {
 		if cs, ok := params["charset"]; ok {
 			encoding = strings.ToLower(strings.TrimSpace(cs))
 		}
@@ -87,6 +143,19 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(req.GetPostFiles()) > 0 {
+		return nil, errors.New("phantomjs does not support file uploads")
+	}
+	// 请求体的类型随任务传递，以免JSON、原始字节与multipart请求体被当作表单提交
+	postData := req.GetPostData()
+	var contentType string
+	if param.body != nil {
+		postData = string(param.body)
+		contentType = param.header.Get("Content-Type")
+		if req.GetPostBytes() != nil && hint != "" {
+			contentType = hint
+		}
+	}
 
 	cookie := ""
 	if req.GetEnableCookie() {
@@ -116,40 +185,46 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 		cookie,
 		encoding,
 		param.header.Get("User-Agent"),
-		req.GetPostData(),
+		postData,
 		strings.ToLower(param.method),
 		fmt.Sprint(int(req.GetDialTimeout() / time.Millisecond)),
+		contentType, // 请求体的Content-Type，为空时按表单提交
 	}
 	if req.GetProxy() != "" {
 		args = append([]string{"--proxy=" + req.GetProxy()}, args...)
 	}
 
+	var job = &PhantomJob{
+		Url:         req.GetUrl(),
+		Method:      strings.ToLower(param.method),
+		PostData:    postData,
+		ContentType: contentType,
+		Cookie:      cookie,
+		Encoding:    encoding,
+		UserAgent:   param.header.Get("User-Agent"),
+		Proxy:       req.GetProxy(),
+		Timeout:     int(req.GetDialTimeout() / time.Millisecond),
+	}
+
+	pool := self.pool()
 	for i := 0; i < param.tryTimes; i++ {
 		if i != 0 {
 			time.Sleep(param.retryPause)
 		}
 
-		cmd := exec.Command(self.PhantomjsFile, args...)
-		if resp.Body, err = cmd.StdoutPipe(); err != nil {
-			continue
-		}
-		err = cmd.Start()
-		if err != nil || resp.Body == nil {
-			continue
-		}
-		var b []byte
-		b, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			continue
+		var retResp *Response
+		if pool != nil {
+			retResp, err = pool.Do(job)
+		} else {
+			retResp, err = self.exec(args)
 		}
-		retResp := Response{}
-		err = json.Unmarshal(b, &retResp)
 		if err != nil {
 			continue
 		}
 
 		if retResp.Error != "" {
 			log.Printf("phantomjs response error:%s", retResp.Error)
+			err = errors.New(retResp.Error)
 			continue
 		}
 
@@ -167,6 +242,16 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 				self.CookieJar.SetCookies(param.url, rc)
 			}
 		}
+		// page.content已由浏览器解码为UTF-8，避免按原始声明的字符集再次转码
+		mediatype, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if mediatype == "" {
+			mediatype = "text/html"
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params["charset"] = "utf-8"
+		resp.Header.Set("Content-Type", mime.FormatMediaType(mediatype, params))
 		resp.Body = ioutil.NopCloser(strings.NewReader(retResp.Body))
 		break
 	}
@@ -177,12 +262,48 @@ func (self *Phantom) Download(req Request) (resp *http.Response, err error) {
 	} else {
 		resp.StatusCode = http.StatusBadGateway
 		resp.Status = err.Error()
+		if resp.Body == nil {
+			resp.Body = ioutil.NopCloser(strings.NewReader(""))
+		}
 	}
 	return
 }
 
 
+func (self *Phantom) exec(args []string) (*Response, error) {
+	cmd := exec.Command(self.PhantomjsFile, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(stdout)
+	cmd.Wait()
+	if err != nil {
+		return nil, err
+	}
+	retResp := &Response{}
+	if err = json.Unmarshal(b, retResp); err != nil {
+		return nil, err
+	}
+	return retResp, nil
+}
+
+
 func (self *Phantom) DestroyJsFiles() {
+	if self.Pool != nil {
+		self.Pool.Close()
+	}
+	if p := self.pooling; p != nil {
+		p.Lock()
+		if p.pool != nil {
+			p.pool.Close()
+			p.pool = nil
+		}
+		p.Unlock()
+	}
 	p, _ := filepath.Split(self.TempJsDir)
 	if p == "" {
 		return
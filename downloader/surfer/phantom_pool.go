@@ -0,0 +1,401 @@
+package surfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// PhantomPool 常驻的无头浏览器进程池
+	// 每个进程从stdin逐行读取PhantomJob(JSON)，并向stdout逐行写回Response(JSON)，
+	// 任何遵循该协议的浏览器程序均可使用。进程异常退出或超时后将被替换。
+	PhantomPool struct {
+		Bin     string
+		Args    []string
+		Size    int
+		Timeout time.Duration // 单个任务的最长等待时间，任务自带超时时在其基础上追加
+		idle    chan *phantomWorker
+		count   int
+		closed  bool
+		sync.Mutex
+	}
+
+	PhantomJob struct {
+		Url         string
+		Method      string
+		PostData    string
+		ContentType string // 请求体的Content-Type，为空时按表单提交
+		Cookie      string
+		Encoding    string
+		UserAgent   string
+		Proxy       string
+		Timeout     int // 毫秒
+	}
+
+	phantomWorker struct {
+		cmd      *exec.Cmd
+		stdin    io.WriteCloser
+		lines    chan []byte
+		exit     chan struct{} // 进程退出后关闭
+		released int32
+	}
+)
+
+var errPoolClosed = errors.New("phantom pool is closed")
+
+func NewPhantomPool(bin string, args []string, size int) *PhantomPool {
+	if size < 1 {
+		size = 1
+	}
+	return &PhantomPool{
+		Bin:     bin,
+		Args:    args,
+		Size:    size,
+		Timeout: time.Minute,
+		idle:    make(chan *phantomWorker, size),
+	}
+}
+
+// Do 将任务交给一个空闲进程执行，无空闲进程且未达上限时启动新进程，否则等待
+func (self *PhantomPool) Do(job *PhantomJob) (*Response, error) {
+	w, err := self.get()
+	if err != nil {
+		return nil, err
+	}
+	ret, err := w.do(job, self.Timeout+time.Duration(job.Timeout)*time.Millisecond)
+	if err != nil {
+		self.discard(w)
+		return nil, err
+	}
+	self.put(w)
+	return ret, nil
+}
+
+// Close 结束全部进程
+func (self *PhantomPool) Close() {
+	self.Lock()
+	defer self.Unlock()
+	if self.closed {
+		return
+	}
+	self.closed = true
+	for {
+		select {
+		case w := <-self.idle:
+			if w.release() {
+				self.count--
+			}
+			w.kill()
+		default:
+			return
+		}
+	}
+}
+
+func (self *PhantomPool) get() (*phantomWorker, error) {
+	for {
+		self.Lock()
+		if self.closed {
+			self.Unlock()
+			return nil, errPoolClosed
+		}
+		select {
+		case w := <-self.idle:
+			self.Unlock()
+			if w.dead() {
+				continue
+			}
+			return w, nil
+		default:
+		}
+		if self.count < self.Size {
+			self.count++
+			self.Unlock()
+			w, err := self.start()
+			if err != nil {
+				self.Lock()
+				self.count--
+				self.Unlock()
+				return nil, err
+			}
+			return w, nil
+		}
+		self.Unlock()
+		select {
+		case w := <-self.idle:
+			if w.dead() {
+				continue
+			}
+			return w, nil
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (self *PhantomPool) put(w *phantomWorker) {
+	self.Lock()
+	defer self.Unlock()
+	if self.closed {
+		if w.release() {
+			self.count--
+		}
+		w.kill()
+		return
+	}
+	select {
+	case self.idle <- w:
+		return
+	default:
+	}
+	// 通道已满时其中必有已退出的进程，清除后再放入
+	for n := len(self.idle); n > 0; n-- {
+		select {
+		case x := <-self.idle:
+			if !x.dead() {
+				self.idle <- x
+			}
+		default:
+		}
+	}
+	self.idle <- w
+}
+
+func (self *PhantomPool) discard(w *phantomWorker) {
+	self.Lock()
+	if w.release() {
+		self.count--
+	}
+	self.Unlock()
+	w.kill()
+}
+
+// exited 进程意外退出时立即补充新进程
+func (self *PhantomPool) exited(w *phantomWorker) {
+	self.Lock()
+	if !w.release() {
+		self.Unlock()
+		return
+	}
+	self.count--
+	if self.closed || self.count >= self.Size {
+		self.Unlock()
+		return
+	}
+	self.count++
+	self.Unlock()
+
+	log.Printf("[E] Surfer: phantom worker exited unexpectedly, restarting\n")
+	nw, err := self.start()
+	if err != nil {
+		log.Printf("[E] Surfer: phantom worker restart: %v\n", err)
+		self.Lock()
+		self.count--
+		self.Unlock()
+		return
+	}
+	self.put(nw)
+}
+
+func (self *PhantomPool) start() (*phantomWorker, error) {
+	cmd := exec.Command(self.Bin, self.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	w := &phantomWorker{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan []byte, 1),
+		exit:  make(chan struct{}),
+	}
+	// 每个进程只有一个读取协程，进程退出（含被结束）后随之退出
+	go func() {
+		r := bufio.NewReaderSize(stdout, 1<<20)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			// 无任务等待时的多余输出直接丢弃，避免阻塞
+			select {
+			case w.lines <- line:
+			default:
+			}
+		}
+		cmd.Wait()
+		close(w.exit)
+		self.exited(w)
+	}()
+	return w, nil
+}
+
+func (self *phantomWorker) do(job *PhantomJob, timeout time.Duration) (*Response, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	// 丢弃上一个任务之后多余的输出
+	for len(self.lines) > 0 {
+		<-self.lines
+	}
+	if _, err = self.stdin.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line := <-self.lines:
+		return parseWorkerLine(line)
+	case <-self.exit:
+		// 进程可能在写回结果后退出
+		select {
+		case line := <-self.lines:
+			return parseWorkerLine(line)
+		default:
+		}
+		return nil, errors.New("phantom worker exited")
+	case <-timer.C:
+		log.Printf("[E] Surfer: phantom worker timeout after %v: %s\n", timeout, job.Url)
+		return nil, fmt.Errorf("phantom worker timeout after %v", timeout)
+	}
+}
+
+func parseWorkerLine(line []byte) (*Response, error) {
+	ret := &Response{}
+	if err := json.Unmarshal(line, ret); err != nil {
+		return nil, fmt.Errorf("phantom worker: %v", err)
+	}
+	return ret, nil
+}
+
+func (self *phantomWorker) dead() bool {
+	select {
+	case <-self.exit:
+		return true
+	default:
+		return false
+	}
+}
+
+// release 进程从池中移除，只有第一次调用返回true
+func (self *phantomWorker) release() bool {
+	return atomic.CompareAndSwapInt32(&self.released, 0, 1)
+}
+
+// kill 结束进程，读取协程随之退出
+func (self *phantomWorker) kill() {
+	self.stdin.Close()
+	if self.cmd.Process != nil {
+		self.cmd.Process.Kill()
+	}
+}
+
+// jsWorker 常驻模式的phantomjs脚本，协议见PhantomPool
+const jsWorker = `
+var system = require('system');
+var webpage = require('webpage');
+
+function reply(ret) {
+	system.stdout.writeLine(JSON.stringify(ret));
+	system.stdout.flush();
+}
+
+function next() {
+	var line = system.stdin.readLine();
+	if (!line) {
+		phantom.exit();
+		return;
+	}
+	var job;
+	try {
+		job = JSON.parse(line);
+	} catch (e) {
+		reply({Error: 'bad job: ' + e});
+		setTimeout(next, 0);
+		return;
+	}
+	run(job);
+}
+
+function run(job) {
+	if (phantom.setProxy) {
+		var m = (job.Proxy || '').match(/^(?:(\w+):\/\/)?(?:([^:@]+)(?::([^@]*))?@)?([^:\/]+)(?::(\d+))?/);
+		if (job.Proxy && m) {
+			phantom.setProxy(m[4], m[5] || '80', m[1] === 'socks5' ? 'socks5' : 'http', m[2] || '', m[3] || '');
+		} else {
+			phantom.setProxy('');
+		}
+	}
+	phantom.clearCookies();
+	if (job.Cookie) {
+		try {
+			JSON.parse(job.Cookie).forEach(function(c) { phantom.addCookie(c); });
+		} catch (e) {}
+	}
+
+	var ret = {Cookies: [], Header: [], Body: '', Error: ''};
+	var page = webpage.create();
+	page.settings.userAgent = job.UserAgent;
+	if (job.Timeout > 0) {
+		page.settings.resourceTimeout = job.Timeout;
+	}
+	page.onResourceReceived = function(r) {
+		if (r.id === 1 && r.stage === 'start') {
+			ret.Header = r.headers.map(function(h) { return {Name: h.name, Value: h.value}; });
+		}
+	};
+	page.onResourceTimeout = function(e) {
+		if (e.id === 1) {
+			ret.Error = e.errorString || 'timeout';
+		}
+	};
+
+	var done = false;
+	var finish = function() {
+		if (done) {
+			return;
+		}
+		done = true;
+		ret.Body = page.content;
+		ret.Cookies = page.cookies.map(function(c) {
+			return c.name + '=' + c.value + '; Domain=' + c.domain + '; Path=' + c.path;
+		});
+		page.close();
+		reply(ret);
+		setTimeout(next, 0);
+	};
+
+	var settings = {
+		operation: job.Method || 'get',
+		data: job.PostData || '',
+		encoding: job.Encoding || 'utf-8'
+	};
+	if (job.ContentType) {
+		settings.headers = {'Content-Type': job.ContentType};
+	}
+	page.open(job.Url, settings, function(status) {
+		if (status !== 'success' && !ret.Error) {
+			ret.Error = 'open ' + job.Url + ': ' + status;
+		}
+		setTimeout(finish, 0);
+	});
+}
+
+next();
+`
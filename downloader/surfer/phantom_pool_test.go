@@ -0,0 +1,172 @@
+package surfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFakePhantomWorker 并非测试，而是供进程池启动的假worker：
+// 链接为sleep时不回复，crash时直接退出，bye时回复后退出，job时回显整个任务，其余回显链接
+func TestFakePhantomWorker(t *testing.T) {
+	if args := flag.Args(); len(args) == 0 || args[0] != "fake-phantom-worker" {
+		return
+	}
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		job := &PhantomJob{}
+		json.Unmarshal(in.Bytes(), job)
+		switch job.Url {
+		case "sleep":
+			time.Sleep(time.Hour)
+		case "crash":
+			os.Exit(2)
+		}
+		body := job.Url
+		if job.Url == "job" {
+			b, _ := json.Marshal(job)
+			body = string(b)
+		}
+		b, _ := json.Marshal(&Response{Body: body})
+		os.Stdout.Write(append(b, '\n'))
+		if job.Url == "bye" {
+			os.Exit(2)
+		}
+	}
+	// 测试期间不允许os.Exit(0)
+	os.Exit(2)
+}
+
+func newFakePool(size int) *PhantomPool {
+	pool := NewPhantomPool(os.Args[0], []string{"-test.run=^TestFakePhantomWorker$", "--", "fake-phantom-worker"}, size)
+	pool.Timeout = 500 * time.Millisecond
+	return pool
+}
+
+func (self *PhantomPool) workers() int {
+	self.Lock()
+	defer self.Unlock()
+	return self.count
+}
+
+func TestPhantomPoolDo(t *testing.T) {
+	pool := newFakePool(2)
+	defer pool.Close()
+	for _, u := range []string{"a", "b", "c"} {
+		resp, err := pool.Do(&PhantomJob{Url: u})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != u {
+			t.Errorf("body = %q, want %q", resp.Body, u)
+		}
+	}
+	if n := pool.workers(); n != 1 {
+		t.Errorf("workers = %d, want 1 reused", n)
+	}
+}
+
+func TestPhantomPoolTimeout(t *testing.T) {
+	pool := newFakePool(1)
+	defer pool.Close()
+	if _, err := pool.Do(&PhantomJob{Url: "sleep"}); err == nil {
+		t.Fatal("want timeout error")
+	}
+	if n := pool.workers(); n != 0 {
+		t.Errorf("workers = %d after timeout, want 0", n)
+	}
+	resp, err := pool.Do(&PhantomJob{Url: "after"})
+	if err != nil || resp.Body != "after" {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+}
+
+func TestPhantomPoolCrash(t *testing.T) {
+	pool := newFakePool(1)
+	defer pool.Close()
+	if _, err := pool.Do(&PhantomJob{Url: "crash"}); err == nil {
+		t.Fatal("want error from crashed worker")
+	}
+	resp, err := pool.Do(&PhantomJob{Url: "after"})
+	if err != nil || resp.Body != "after" {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+}
+
+func TestPhantomPoolReplaceExited(t *testing.T) {
+	pool := newFakePool(1)
+	defer pool.Close()
+	w, err := pool.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := w.do(&PhantomJob{Url: "bye"}, pool.Timeout)
+	if err != nil || resp.Body != "bye" {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+	pool.put(w)
+	<-w.exit
+
+	// 空闲进程退出后应立即补充
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var nw *phantomWorker
+		pool.Lock()
+		if len(pool.idle) > 0 {
+			nw = <-pool.idle
+			pool.idle <- nw
+		}
+		pool.Unlock()
+		if nw != nil && nw != w && !nw.dead() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("exited worker was not replaced")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	resp, err = pool.Do(&PhantomJob{Url: "after"})
+	if err != nil || resp.Body != "after" {
+		t.Fatalf("resp = %v, err = %v", resp, err)
+	}
+}
+
+func TestPhantomContentType(t *testing.T) {
+	phantom := &Phantom{Pool: newFakePool(1)}
+	phantom.CookieJar, _ = cookiejar.New(nil)
+	defer phantom.Pool.Close()
+
+	cases := []struct {
+		req  *DefaultRequest
+		want string
+	}{
+		{&DefaultRequest{Method: "POST", PostJson: map[string]int{"a": 1}}, "application/json; charset=utf-8"},
+		{&DefaultRequest{Method: "POST", PostBytes: []byte("<a/>"), Header: http.Header{"Content-Type": {"application/xml"}}}, "application/xml"},
+		{&DefaultRequest{Method: "POST", PostBytes: []byte{1, 2}}, "application/octet-stream"},
+		{&DefaultRequest{Method: "POST-M", PostData: "a=1"}, "multipart/form-data; boundary="},
+		{&DefaultRequest{Method: "POST", PostData: "a=1"}, "application/x-www-form-urlencoded"},
+		{&DefaultRequest{}, ""},
+	}
+	for _, c := range cases {
+		c.req.Url = "job"
+		resp, err := phantom.Download(c.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		job := &PhantomJob{}
+		if err := json.Unmarshal(b, job); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		if !strings.HasPrefix(job.ContentType, c.want) || (c.want == "") != (job.ContentType == "") {
+			t.Errorf("%s: ContentType = %q, want %q", c.req.Method, job.ContentType, c.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package surfer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"go-spider/downloader/surfer/agent"
+)
+
+// captureHead 启动仅接受一次连接的服务，返回其地址与收到的请求头各行
+func captureHead(t *testing.T) (string, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		c, err := ln.Accept()
+		if err != nil {
+			lines <- nil
+			return
+		}
+		defer c.Close()
+		var head []string
+		r := bufio.NewReader(c)
+		for {
+			line, err := r.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			if err != nil || line == "" {
+				break
+			}
+			head = append(head, line)
+		}
+		c.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+		lines <- head
+	}()
+	return "http://" + ln.Addr().String() + "/", lines
+}
+
+func TestProfileHeaderOrder(t *testing.T) {
+	p, ok := agent.GetProfile("firefox-windows")
+	if !ok {
+		t.Fatal("firefox-windows not found")
+	}
+	addr, lines := captureHead(t)
+	resp, err := New().Download(&DefaultRequest{Url: addr, Profile: p.Name, TryTimes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	head := <-lines
+	if len(head) < 2 {
+		t.Fatalf("got %q", head)
+	}
+	rank := map[string]int{}
+	for i, k := range p.Order() {
+		rank[textproto.CanonicalMIMEHeaderKey(k)] = i
+	}
+	last := -1
+	for _, line := range head[1:] {
+		name := textproto.CanonicalMIMEHeaderKey(line[:strings.IndexByte(line, ':')])
+		r, ok := rank[name]
+		if !ok {
+			t.Errorf("unexpected header %q", line)
+			continue
+		}
+		if r < last {
+			t.Errorf("header %s out of profile order: %q", name, head)
+		}
+		last = r
+	}
+	if got := headValue(head, "User-Agent"); got != p.UserAgent() {
+		t.Errorf("User-Agent = %q", got)
+	}
+}
+
+func headValue(head []string, name string) string {
+	for _, line := range head {
+		if i := strings.IndexByte(line, ':'); i > 0 && strings.EqualFold(line[:i], name) {
+			return strings.TrimSpace(line[i+1:])
+		}
+	}
+	return ""
+}
+
+// writeConn 记录写出的数据
+type writeConn struct {
+	net.Conn
+	bytes.Buffer
+}
+
+func (self *writeConn) Write(p []byte) (int, error) {
+	return self.Buffer.Write(p)
+}
+
+func TestOrderedConn(t *testing.T) {
+	w := &writeConn{}
+	c := newOrderedConn(w, []string{"Host", "X-B", "X-A"})
+	c.Write([]byte("GET / HTTP/1.1\r\nX-A: 1\r\nHost: exa"))
+	c.Write([]byte("mple.com\r\nX-C: 3\r\nX-B: 2\r\n\r\nbody"))
+	c.Write([]byte("more"))
+	want := "GET / HTTP/1.1\r\nHost: example.com\r\nX-B: 2\r\nX-A: 1\r\nX-C: 3\r\n\r\nbodymore"
+	if got := w.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPickProfile(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		if p := pickProfile("chrome-windows, firefox-windows", "chrome-windows"); p == nil || p.Name != "firefox-windows" {
+			t.Fatalf("got %v, want firefox-windows", p)
+		}
+	}
+	// 仅有的指纹即为except时仍使用它
+	if p := pickProfile("chrome-windows", "chrome-windows"); p == nil || p.Name != "chrome-windows" {
+		t.Errorf("got %v", p)
+	}
+	if p := pickProfile("no-such-profile", ""); p != nil {
+		t.Errorf("got %v, want nil", p)
+	}
+}
+
+func TestNewParamProfile(t *testing.T) {
+	// 未指定指纹时保持原有行为，仅设置User-Agent
+	param, err := NewParam(&DefaultRequest{Url: "http://example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if param.profile != nil || param.header.Get("User-Agent") == "" || param.header.Get("Sec-Fetch-Mode") != "" {
+		t.Errorf("profile = %v, header = %v", param.profile, param.header)
+	}
+
+	param, _ = NewParam(&DefaultRequest{Url: "http://example.com/", Profile: "safari-mac"})
+	safari, _ := agent.GetProfile("safari-mac")
+	if param.profile != safari || param.header.Get("User-Agent") != safari.UserAgent() {
+		t.Errorf("profile = %v, header = %v", param.profile, param.header)
+	}
+
+	header := http.Header{"User-Agent": {"custom"}}
+	param, _ = NewParam(&DefaultRequest{Url: "http://example.com/", Profile: "safari-mac", Header: header})
+	if got := param.header.Get("User-Agent"); got != "custom" {
+		t.Errorf("User-Agent = %q, want the request's own", got)
+	}
+	// 启用Cookie时只使用第一个指纹
+	param, _ = NewParam(&DefaultRequest{Url: "http://example.com/", Profile: "edge-windows,safari-mac", EnableCookie: true})
+	if param.profile == nil || param.profile.Name != "edge-windows" {
+		t.Errorf("profile = %v", param.profile)
+	}
+}
+
+func TestDeflateReader(t *testing.T) {
+	var zbuf, fbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("zlib body"))
+	zw.Close()
+	fw, _ := flate.NewWriter(&fbuf, flate.DefaultCompression)
+	fw.Write([]byte("raw body"))
+	fw.Close()
+
+	for want, data := range map[string][]byte{"zlib body": zbuf.Bytes(), "raw body": fbuf.Bytes()} {
+		r, err := deflateReader(ioutil.NopCloser(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || string(got) != want {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+}
@@ -16,6 +16,12 @@ type (
 		
 		GetPostData() string
 		
+		GetPostJson() interface{}
+		
+		GetPostBytes() []byte
+		
+		GetPostFiles() []PostFile
+		
 		GetHeader() http.Header
 		
 		GetEnableCookie() bool
@@ -33,6 +39,8 @@ type (
 		GetRedirectTimes() int
 		
 		GetDownloaderID() int
+		
+		GetProfile() string
 	}
 
 	
@@ -48,6 +56,12 @@ type (
 		
 		PostData string
 		
+		PostJson interface{}
+		
+		PostBytes []byte
+		
+		PostFiles []PostFile
+		
 		DialTimeout time.Duration
 		
 		ConnTimeout time.Duration
@@ -61,9 +75,19 @@ type (
 		Proxy string
 
 		DownloaderID int
+		
+		Profile string
 
 		once sync.Once
 	}
+
+	// PostFile multipart请求中的文件部分
+	PostFile struct {
+		Field       string
+		Name        string
+		ContentType string
+		Data        []byte
+	}
 )
 
 const (
@@ -130,6 +154,24 @@ func (self *DefaultRequest) GetPostData() string {
 }
 
 
+func (self *DefaultRequest) GetPostJson() interface{} {
+	self.once.Do(self.prepare)
+	return self.PostJson
+}
+
+
+func (self *DefaultRequest) GetPostBytes() []byte {
+	self.once.Do(self.prepare)
+	return self.PostBytes
+}
+
+
+func (self *DefaultRequest) GetPostFiles() []PostFile {
+	self.once.Do(self.prepare)
+	return self.PostFiles
+}
+
+
 func (self *DefaultRequest) GetHeader() http.Header {
 	self.once.Do(self.prepare)
 	return self.Header
@@ -182,3 +224,9 @@ func (self *DefaultRequest) GetDownloaderID() int {
 	self.once.Do(self.prepare)
 	return self.DownloaderID
 }
+
+
+func (self *DefaultRequest) GetProfile() string {
+	self.once.Do(self.prepare)
+	return self.Profile
+}
@@ -1,6 +1,7 @@
 package surfer
 
 import (
+	"bufio"
 	"compress/flate"
 	"compress/gzip"
 	"compress/zlib"
@@ -40,7 +41,7 @@ func (self *Surf) Download(req Request) (resp *http.Response, err error) {
 	}
 	param.header.Set("Connection", "close")
 	param.client = self.buildClient(param)
-	resp, err = self.httpRequest(param)
+	resp, err = self.httpRequest(param, req)
 
 	if err == nil {
 		switch resp.Header.Get("Content-Encoding") {
@@ -52,7 +53,11 @@ func (self *Surf) Download(req Request) (resp *http.Response, err error) {
 			}
 
 		case "deflate":
-			resp.Body = flate.NewReader(resp.Body)
+			var readCloser io.ReadCloser
+			readCloser, err = deflateReader(resp.Body)
+			if err == nil {
+				resp.Body = readCloser
+			}
 
 		case "zlib":
 			var readCloser io.ReadCloser
@@ -68,6 +73,20 @@ func (self *Surf) Download(req Request) (resp *http.Response, err error) {
 	return
 }
 
+// deflateReader HTTP的deflate编码为zlib封装的数据，部分服务器发送裸deflate数据，按首部区分
+func deflateReader(body io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(body)
+	head, err := br.Peek(2)
+	if err == nil && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &Body{ReadCloser: body, Reader: zr}, nil
+	}
+	return &Body{ReadCloser: body, Reader: flate.NewReader(br)}, nil
+}
+
 var dnsCache = &DnsCache{ipPortLib: goutil.AtomicMap()}
 
 
@@ -104,35 +123,43 @@ func (self *Surf) buildClient(param *Param) *http.Client {
 		client.Jar = self.CookieJar
 	}
 
+	dial := func(network, addr string) (net.Conn, error) {
+		var (
+			c          net.Conn
+			err        error
+			ipPort, ok = dnsCache.Query(addr)
+		)
+		if !ok {
+			ipPort = addr
+			defer func() {
+				if err == nil {
+					dnsCache.Reg(addr, c.RemoteAddr().String())
+				}
+			}()
+		} else {
+			defer func() {
+				if err != nil {
+					dnsCache.Del(addr)
+				}
+			}()
+		}
+		c, err = net.DialTimeout(network, ipPort, param.dialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if param.connTimeout > 0 {
+			c.SetDeadline(time.Now().Add(param.connTimeout))
+		}
+		return c, nil
+	}
+
 	transport := &http.Transport{
 		Dial: func(network, addr string) (net.Conn, error) {
-			var (
-				c          net.Conn
-				err        error
-				ipPort, ok = dnsCache.Query(addr)
-			)
-			if !ok {
-				ipPort = addr
-				defer func() {
-					if err == nil {
-						dnsCache.Reg(addr, c.RemoteAddr().String())
-					}
-				}()
-			} else {
-				defer func() {
-					if err != nil {
-						dnsCache.Del(addr)
-					}
-				}()
-			}
-			c, err = net.DialTimeout(network, ipPort, param.dialTimeout)
+			c, err := dial(network, addr)
 			if err != nil {
 				return nil, err
 			}
-			if param.connTimeout > 0 {
-				c.SetDeadline(time.Now().Add(param.connTimeout))
-			}
-			return c, nil
+			return newOrderedConn(c, param.headerOrder()), nil
 		},
 	}
 
@@ -143,14 +170,29 @@ func (self *Surf) buildClient(param *Param) *http.Client {
 	if strings.ToLower(param.url.Scheme) == "https" {
 		transport.TLSClientConfig = &tls.Config{RootCAs: nil, InsecureSkipVerify: true}
 		transport.DisableCompression = true
+		if param.proxy == nil && param.profile != nil {
+			transport.DialTLS = func(network, addr string) (net.Conn, error) {
+				c, err := dial(network, addr)
+				if err != nil {
+					return nil, err
+				}
+				host, _, _ := net.SplitHostPort(addr)
+				tc := tls.Client(c, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+				if err = tc.Handshake(); err != nil {
+					c.Close()
+					return nil, err
+				}
+				return newOrderedConn(tc, param.headerOrder()), nil
+			}
+		}
 	}
 	client.Transport = transport
 	return client
 }
 
 
-func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
-	req, err := http.NewRequest(param.method, param.url.String(), param.body)
+func (self *Surf) httpRequest(param *Param, sreq Request) (resp *http.Response, err error) {
+	req, err := http.NewRequest(param.method, param.url.String(), param.bodyReader())
 	if err != nil {
 		return nil, err
 	}
@@ -159,9 +201,12 @@ func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 
 	if param.tryTimes <= 0 {
 		for {
+			param.resetBody(req)
 			resp, err = param.client.Do(req)
 			if err != nil {
-				if !param.enableCookie {
+				if param.profile != nil {
+					param.rotateProfile(sreq)
+				} else if !param.enableCookie {
 					l := len(agent.UserAgents["common"])
 					r := rand.New(rand.NewSource(time.Now().UnixNano()))
 					req.Header.Set("User-Agent", agent.UserAgents["common"][r.Intn(l)])
@@ -173,9 +218,12 @@ func (self *Surf) httpRequest(param *Param) (resp *http.Response, err error) {
 		}
 	} else {
 		for i := 0; i < param.tryTimes; i++ {
+			param.resetBody(req)
 			resp, err = param.client.Do(req)
 			if err != nil {
-				if !param.enableCookie {
+				if param.profile != nil {
+					param.rotateProfile(sreq)
+				} else if !param.enableCookie {
 					l := len(agent.UserAgents["common"])
 					r := rand.New(rand.NewSource(time.Now().UnixNano()))
 					req.Header.Set("User-Agent", agent.UserAgents["common"][r.Intn(l)])
@@ -3,11 +3,14 @@ package collector
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 	"go-spider/pipeline/collector/data"
 	"go-spider/spider"
+	"go-spider/logs"
 	"go-spider/runtime/cache"
 )
 
@@ -177,7 +180,24 @@ func (self *Collector) addFileSum(add uint64) {
 	self.sum[3] += add
 }
 
+// reportRules 记录声明了Schema的规则通过与未通过校验的数据条数，计数取自Spider.Stat()
+func (self *Collector) reportRules() {
+	sum := self.Spider.Stat().Rules
+	var names []string
+	for name, rule := range self.Spider.GetRules() {
+		if len(rule.Schema) > 0 && !strings.HasSuffix(name, spider.REJECTS_SUFFIX) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		logs.Log.Informational(" *     [%s] 规则 %s: 有效数据 %d 条，无效数据 %d 条\n",
+			self.Spider.GetName(), name, sum[name], sum[name+spider.REJECTS_SUFFIX])
+	}
+}
+
 func (self *Collector) Report() {
+	self.reportRules()
 	cache.ReportChan <- &cache.Report{
 		SpiderName: self.Spider.GetName(),
 		Keyin:      self.GetKeyin(),
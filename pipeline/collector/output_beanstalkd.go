@@ -31,9 +31,13 @@ func init() {
 			var subNamespace = util.FileNameReplace(self.subNamespace(datacell))
 
 			tmp := make(map[string]interface{})
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			rule := self.MustGetRule(datacell["RuleName"].(string))
+			for _, title := range rule.ItemFields {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
+				// 声明了类型的字段保留其JSON类型
+				if rule.SchemaField(title) != nil {
+					tmp[title] = vd[title]
+				} else if v, ok := vd[title].(string); ok || vd[title] == nil {
 					tmp[title] = v
 				} else {
 					tmp[title] = util.JsonString(vd[title])
@@ -60,13 +60,10 @@ func init() {
 			}
 
 			row := []string{}
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			rule := self.MustGetRule(datacell["RuleName"].(string))
+			for _, title := range rule.ItemFields {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					row = append(row, v)
-				} else {
-					row = append(row, util.JsonString(vd[title]))
-				}
+				row = append(row, cellText(rule.SchemaField(title), vd[title]))
 			}
 			if self.Spider.OutDefaultField() {
 				row = append(row, datacell["Url"].(string))
@@ -7,6 +7,7 @@ import (
 	"go-spider/common/mysql"
 	"go-spider/common/util"
 	"go-spider/logs"
+	"go-spider/spider"
 )
 
 
@@ -52,8 +53,9 @@ func init() {
 				} else {
 					table = mysql.New()
 					table.SetTableName(tName)
-					for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
-						table.AddColumn(title + ` MEDIUMTEXT`)
+					rule := self.MustGetRule(datacell["RuleName"].(string))
+					for _, title := range rule.ItemFields {
+						table.AddColumn(title + ` ` + mysqlColumnType(rule.SchemaField(title)))
 					}
 					if self.Spider.OutDefaultField() {
 						table.AddColumn(`Url VARCHAR(255)`, `ParentUrl VARCHAR(255)`, `DownloadTime VARCHAR(50)`)
@@ -68,13 +70,10 @@ func init() {
 				}
 			}
 			data := []string{}
-			for _, title := range self.MustGetRule(datacell["RuleName"].(string)).ItemFields {
+			rule := self.MustGetRule(datacell["RuleName"].(string))
+			for _, title := range rule.ItemFields {
 				vd := datacell["Data"].(map[string]interface{})
-				if v, ok := vd[title].(string); ok || vd[title] == nil {
-					data = append(data, v)
-				} else {
-					data = append(data, util.JsonString(vd[title]))
-				}
+				data = append(data, cellText(rule.SchemaField(title), vd[title]))
 			}
 			if self.Spider.OutDefaultField() {
 				data = append(data, datacell["Url"].(string), datacell["ParentUrl"].(string), datacell["DownloadTime"].(string))
@@ -88,3 +87,25 @@ func init() {
 		return nil
 	}
 }
+
+// mysqlColumnType 按字段声明的类型选择列类型，未声明的字段为MEDIUMTEXT；
+// 非必填且无默认值的time字段可能为空，使用VARCHAR以免写入空字符串失败
+func mysqlColumnType(f *spider.SchemaField) string {
+	if f == nil {
+		return `MEDIUMTEXT`
+	}
+	switch f.Type {
+	case spider.FIELD_INT:
+		return `BIGINT`
+	case spider.FIELD_FLOAT:
+		return `DOUBLE`
+	case spider.FIELD_BOOL:
+		return `TINYINT(1)`
+	case spider.FIELD_TIME:
+		if f.Required || f.Default != nil {
+			return `DATETIME`
+		}
+		return `VARCHAR(19)`
+	}
+	return `MEDIUMTEXT`
+}
@@ -1,9 +1,38 @@
 package collector
 
 import (
+	"strconv"
+
+	"go-spider/common/util"
 	"go-spider/logs"
+	"go-spider/spider"
 )
 
+// cellText 将数据转为文本列的取值，字符串原样输出；声明了Schema类型的字段中数值与布尔值按字面输出，
+// 其余非字符串取JSON文本，与未声明Schema的规则一致
+func cellText(f *spider.SchemaField, v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	if f != nil {
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return "1"
+			}
+			return "0"
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return util.JsonString(v)
+}
+
 
 func (self *Collector) namespace() string {
 	if self.Spider.Namespace == nil {
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"testing"
+
+	"go-spider/spider"
+)
+
+func TestCellText(t *testing.T) {
+	typed := &spider.SchemaField{Name: "n", Type: spider.FIELD_BOOL}
+	cases := []struct {
+		f    *spider.SchemaField
+		v    interface{}
+		want string
+	}{
+		{nil, "a", "a"},
+		{nil, nil, ""},
+		{nil, true, "true"},
+		{nil, []string{"a"}, `["a"]`},
+		{typed, true, "1"},
+		{typed, false, "0"},
+		{typed, int64(1<<53 + 1), "9007199254740993"},
+		{typed, 1.5, "1.5"},
+		{typed, []interface{}{"a"}, `["a"]`},
+	}
+	for _, c := range cases {
+		if got := cellText(c.f, c.v); got != c.want {
+			t.Errorf("cellText(%v, %#v) = %q, want %q", c.f != nil, c.v, got, c.want)
+		}
+	}
+}
@@ -22,6 +22,7 @@ type Matrix struct {
 	history         history.Historier           
 	tempHistory     map[string]bool             
 	failures        map[string]*request.Request 
+	sessions        map[string]bool // 使用过的代理会话，结束时解除绑定
 	tempHistoryLock sync.RWMutex
 	failureLock     sync.Mutex
 	sync.Mutex
@@ -36,6 +37,7 @@ func newMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
 		history:     history.New(spiderName, spiderSubName),
 		tempHistory: make(map[string]bool),
 		failures:    make(map[string]*request.Request),
+		sessions:    make(map[string]bool),
 	}
 	if cache.Task.Mode != status.SERVER {
 		matrix.history.ReadSuccess(cache.Task.OutType, cache.Task.SuccessInherit)
@@ -119,11 +121,20 @@ func (self *Matrix) Pull() (req *request.Request) {
 		if len(self.reqs[idx]) > 0 {
 			req = self.reqs[idx][0]
 			self.reqs[idx] = self.reqs[idx][1:]
+			session := req.GetProxySession()
+			if session != "" {
+				self.sessions[session] = true
+			}
 			if req.GetProxy() != "" {
 				return
 			}
 			if sdl.useProxy {
-				req.SetProxy(sdl.proxy.GetOne(req.GetUrl()))
+				if session != "" {
+					p, renewed := sdl.proxy.GetSticky(session, req.GetUrl())
+					req.SetProxy(p).SetSessionRenewed(renewed)
+				} else {
+					req.SetProxy(sdl.proxy.GetOne(req.GetUrl()))
+				}
 			} else {
 				req.SetProxy("")
 			}
@@ -176,6 +187,44 @@ func (self *Matrix) DoHistory(req *request.Request, ok bool) bool {
 	return false
 }
 
+// MarkSuccess 将任意标识（如Feed条目的GUID）记入成功记录，已存在时返回false
+func (self *Matrix) MarkSuccess(unique string) bool {
+	return self.history.UpsertSuccess(unique)
+}
+
+// HasSuccess 返回MarkSuccess是否已记录该标识
+func (self *Matrix) HasSuccess(unique string) bool {
+	return self.history.HasSuccess(unique)
+}
+
+// ReleaseSessions 解除本蜘蛛使用过的代理会话与代理IP的绑定，并执行OnReleaseSession注册的回调
+func (self *Matrix) ReleaseSessions() {
+	self.Lock()
+	sessions := self.sessions
+	self.sessions = make(map[string]bool)
+	self.Unlock()
+	releasersLock.RLock()
+	defer releasersLock.RUnlock()
+	for session := range sessions {
+		sdl.proxy.ReleaseSession(session)
+		for _, f := range releasers {
+			f(session)
+		}
+	}
+}
+
+var (
+	releasers     []func(session string)
+	releasersLock sync.RWMutex
+)
+
+// OnReleaseSession 注册代理会话结束时的回调，如下载器清理会话的Cookie
+func OnReleaseSession(f func(session string)) {
+	releasersLock.Lock()
+	releasers = append(releasers, f)
+	releasersLock.Unlock()
+}
+
 func (self *Matrix) CanStop() bool {
 	if sdl.checkStatus(status.STOP) {
 		return true
@@ -0,0 +1,21 @@
+package scheduler
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReleaseSessions(t *testing.T) {
+	var released []string
+	OnReleaseSession(func(session string) { released = append(released, session) })
+	m := &Matrix{sessions: map[string]bool{"a": true, "b": true}}
+	m.ReleaseSessions()
+	sort.Strings(released)
+	if !reflect.DeepEqual(released, []string{"a", "b"}) {
+		t.Errorf("released %q", released)
+	}
+	if len(m.sessions) != 0 {
+		t.Errorf("sessions not cleared: %v", m.sessions)
+	}
+}
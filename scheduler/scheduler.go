@@ -1,9 +1,12 @@
 package scheduler
 
 import (
+	"net/http"
 	"sync"
+	"time"
 
 	"go-spider/aid/proxy"
+	"go-spider/downloader/request"
 	"go-spider/logs"
 	"go-spider/runtime/cache"
 	"go-spider/runtime/status"
@@ -30,15 +33,16 @@ var sdl = &scheduler{
 func Init() {
 	sdl.matrices = []*Matrix{}
 	sdl.count = make(chan bool, cache.Task.ThreadNum)
+	resetSiteStats()
 
+	// 是否使用代理IP在每次分配请求时按在线数量判断，之后就绪的代理IP同样会被使用
 	if cache.Task.ProxyMinute > 0 {
+		sdl.useProxy = true
+		sdl.proxy.UpdateTicker(cache.Task.ProxyMinute)
 		if sdl.proxy.Count() > 0 {
-			sdl.useProxy = true
-			sdl.proxy.UpdateTicker(cache.Task.ProxyMinute)
-			logs.Log.Informational(" *     使用代理IP，代理IP更换频率为 %v 分钟\n", cache.Task.ProxyMinute)
+			logs.Log.Informational(" *     使用代理IP，代理IP健康检查频率为 %v 分钟\n", cache.Task.ProxyMinute)
 		} else {
-			sdl.useProxy = false
-			logs.Log.Informational(" *     在线代理IP列表为空，无法使用代理IP\n")
+			logs.Log.Informational(" *     在线代理IP列表暂为空，就绪后开始使用，健康检查频率为 %v 分钟\n", cache.Task.ProxyMinute)
 		}
 	} else {
 		sdl.useProxy = false
@@ -53,6 +57,49 @@ func ReloadProxyLib() {
 	sdl.proxy.Update()
 }
 
+// AddProxySource 添加代理IP来源，随代理IP库定期刷新
+func AddProxySource(src proxy.ProxySource) {
+	sdl.proxy.AddSource(src)
+}
+
+// RemoveProxySource 按名称移除代理IP来源
+func RemoveProxySource(name string) {
+	sdl.proxy.RemoveSource(name)
+}
+
+// SetTaskProxies 设置任务配置中下发的代理IP列表，为空时移除；健康检查在后台进行，不阻塞任务
+func SetTaskProxies(proxys []string) {
+	src := proxy.NewStaticSource("task", proxys)
+	if len(proxys) == 0 {
+		sdl.proxy.RemoveSource(src.Name())
+		return
+	}
+	sdl.proxy.AddSource(src)
+}
+
+
+// ProxyFeedback 将请求的下载结果反馈给代理IP评分，命中封禁页面时返回proxy.ErrBanned
+func ProxyFeedback(req *request.Request, resp *http.Response, err error, latency time.Duration) error {
+	p := req.GetProxy()
+	if p == "" {
+		return err
+	}
+	if proxy.IsBanPage(resp) {
+		if err == nil {
+			err = proxy.ErrBanned
+		}
+		sdl.proxy.Feedback(p, req.GetUrl(), proxy.ErrBanned, latency)
+		return err
+	}
+	if resp != nil && resp.StatusCode > 0 && resp.StatusCode < 500 {
+		// 目标站点的4xx与代理IP无关
+		sdl.proxy.Feedback(p, req.GetUrl(), nil, latency)
+	} else {
+		sdl.proxy.Feedback(p, req.GetUrl(), err, latency)
+	}
+	return err
+}
+
 
 func AddMatrix(spiderName, spiderSubName string, maxPage int64) *Matrix {
 	matrix := newMatrix(spiderName, spiderSubName, maxPage)
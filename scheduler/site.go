@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go-spider/aid/domain"
+)
+
+// SiteStat 按可注册域名汇总的抓取统计
+type SiteStat struct {
+	Site     string
+	Requests int64
+	Success  int64
+	Failure  int64
+	Latency  time.Duration // 平均耗时
+}
+
+type siteTable struct {
+	stats     map[string]*SiteStat
+	intervals map[string]time.Duration
+	next      map[string]time.Time
+	sync.Mutex
+}
+
+var sites = &siteTable{
+	stats:     make(map[string]*SiteStat),
+	intervals: make(map[string]time.Duration),
+	next:      make(map[string]time.Time),
+}
+
+// SetSiteInterval 设置对同一站点（按可注册域名，www.example.com与example.com视为同一站点）
+// 两次请求之间的最小间隔，跨全部蜘蛛生效；d为0时取消
+func SetSiteInterval(site string, d time.Duration) {
+	site = domain.Registrable(site)
+	sites.Lock()
+	defer sites.Unlock()
+	if d <= 0 {
+		delete(sites.intervals, site)
+		delete(sites.next, site)
+		return
+	}
+	sites.intervals[site] = d
+}
+
+// WaitSite 按站点的最小间隔等待至可以发起请求
+func WaitSite(u string) {
+	site := domain.FromURL(u)
+	sites.Lock()
+	d, ok := sites.intervals[site]
+	if !ok {
+		sites.Unlock()
+		return
+	}
+	now := time.Now()
+	at := sites.next[site]
+	if at.Before(now) {
+		at = now
+	}
+	sites.next[site] = at.Add(d)
+	sites.Unlock()
+	time.Sleep(at.Sub(now))
+}
+
+// SiteFeedback 记录一次请求的结果
+func SiteFeedback(u string, err error, latency time.Duration) {
+	site := domain.FromURL(u)
+	if site == "" {
+		return
+	}
+	sites.Lock()
+	defer sites.Unlock()
+	s, ok := sites.stats[site]
+	if !ok {
+		s = &SiteStat{Site: site}
+		sites.stats[site] = s
+	}
+	s.Latency = (s.Latency*time.Duration(s.Requests) + latency) / time.Duration(s.Requests+1)
+	s.Requests++
+	if err == nil {
+		s.Success++
+	} else {
+		s.Failure++
+	}
+}
+
+// SiteStats 返回本次运行各站点的统计，按请求数降序
+func SiteStats() []SiteStat {
+	sites.Lock()
+	stats := make([]SiteStat, 0, len(sites.stats))
+	for _, s := range sites.stats {
+		stats = append(stats, *s)
+	}
+	sites.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Requests != stats[j].Requests {
+			return stats[i].Requests > stats[j].Requests
+		}
+		return stats[i].Site < stats[j].Site
+	})
+	return stats
+}
+
+func resetSiteStats() {
+	sites.Lock()
+	sites.stats = make(map[string]*SiteStat)
+	sites.next = make(map[string]time.Time)
+	sites.Unlock()
+}
@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSiteFeedback(t *testing.T) {
+	resetSiteStats()
+	SiteFeedback("http://www.example.com/a", nil, time.Second)
+	SiteFeedback("http://example.com/b", errors.New("timeout"), 3*time.Second)
+	SiteFeedback("http://a.example.co.uk/", nil, time.Second)
+
+	stats := SiteStats()
+	if len(stats) != 2 {
+		t.Fatalf("got %d sites, want 2: %+v", len(stats), stats)
+	}
+	s := stats[0]
+	if s.Site != "example.com" || s.Requests != 2 || s.Success != 1 || s.Failure != 1 || s.Latency != 2*time.Second {
+		t.Errorf("got %+v", s)
+	}
+	if stats[1].Site != "example.co.uk" {
+		t.Errorf("got %+v", stats[1])
+	}
+}
+
+func TestWaitSite(t *testing.T) {
+	SetSiteInterval("www.example.com", 50*time.Millisecond)
+	defer SetSiteInterval("example.com", 0)
+
+	t0 := time.Now()
+	for i := 0; i < 3; i++ {
+		WaitSite("http://example.com/")
+	}
+	if d := time.Since(t0); d < 100*time.Millisecond {
+		t.Errorf("3 requests took %v, want at least 100ms", d)
+	}
+
+	t0 = time.Now()
+	WaitSite("http://other.com/")
+	if d := time.Since(t0); d > 20*time.Millisecond {
+		t.Errorf("unlimited site waited %v", d)
+	}
+}
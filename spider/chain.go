@@ -0,0 +1,271 @@
+package spider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go-spider/downloader/request"
+	"go-spider/logs"
+	"go-spider/pipeline/collector/data"
+)
+
+// 下游蜘蛛接收上游取值的方式
+const (
+	CHAIN_KEYIN   = "keyin"   // 作为自定义配置执行一次Root
+	CHAIN_REQUEST = "request" // 作为链接以指定规则加入队列
+)
+
+// CHAIN_KEYIN_TEMP 以CHAIN_KEYIN方式派生的请求在Temp中记录所属的自定义配置，并参与请求去重
+const CHAIN_KEYIN_TEMP = request.KEYIN_TEMP
+
+// ChainBuffer 上下游之间默认的缓冲数量，下游启动后缓冲满时上游阻塞
+var ChainBuffer = 100
+
+type (
+	// feed 上游蜘蛛向下游蜘蛛传递取值的有界通道
+	feed struct {
+		as      string
+		rule    string // CHAIN_REQUEST时的规则
+		ch      chan string
+		done    chan struct{} // 下游结束后关闭，使上游不再阻塞
+		started chan struct{} // 下游开始接收后关闭
+		backlog []string      // 下游启动前暂存的取值
+		seen    map[string]bool
+		senders int32 // 尚未结束的上游数量
+		pending int32 // 已发送但下游尚未处理完的取值数量
+		lock    sync.Mutex
+		once    sync.Once
+	}
+	// feedOut 上游一侧的取值声明
+	feedOut struct {
+		*feed
+		fromRule string
+		field    string
+	}
+)
+
+// ChainTo 将本蜘蛛fromRule规则（为空时不限）输出数据的field字段值传递给下游蜘蛛down；
+// as为CHAIN_KEYIN或CHAIN_REQUEST，后者以rule规则加入下游队列；相同取值只传递一次
+func (self *Spider) ChainTo(down *Spider, fromRule, field, as, rule string, buffer int) error {
+	switch {
+	case down == self:
+		return fmt.Errorf("蜘蛛 %s 不能串联自身", self.GetName())
+	case field == "":
+		return fmt.Errorf("串联 %s -> %s 未指定字段", self.GetName(), down.GetName())
+	case as == "":
+		as = CHAIN_KEYIN
+	case as != CHAIN_KEYIN && as != CHAIN_REQUEST:
+		return fmt.Errorf("串联 %s -> %s 的方式 %q 无效", self.GetName(), down.GetName(), as)
+	}
+	if as == CHAIN_REQUEST {
+		if _, ok := down.GetRule(rule); !ok {
+			return fmt.Errorf("蜘蛛 %s 不存在规则 %s", down.GetName(), rule)
+		}
+	}
+	if buffer <= 0 {
+		buffer = ChainBuffer
+	}
+	// 同一下游、同一方式的多个上游共用一个通道，以便统一去重
+	var f *feed
+	for _, in := range down.feedsIn {
+		if in.as == as && in.rule == rule {
+			f = in
+			break
+		}
+	}
+	if f == nil {
+		f = &feed{
+			as:      as,
+			rule:    rule,
+			ch:      make(chan string, buffer),
+			done:    make(chan struct{}),
+			started: make(chan struct{}),
+			seen:    make(map[string]bool),
+		}
+		down.feedsIn = append(down.feedsIn, f)
+	}
+	atomic.AddInt32(&f.senders, 1)
+	self.feedsOut = append(self.feedsOut, &feedOut{feed: f, fromRule: fromRule, field: field})
+	return nil
+}
+
+// Emit 将一条输出数据按串联声明传递给下游，下游已启动且缓冲满时阻塞
+func (self *Spider) Emit(cell data.DataCell) {
+	if len(self.feedsOut) == 0 {
+		return
+	}
+	ruleName, _ := cell["RuleName"].(string)
+	item, _ := cell["Data"].(map[string]interface{})
+	for _, out := range self.feedsOut {
+		if out.fromRule == "" && strings.HasSuffix(ruleName, REJECTS_SUFFIX) {
+			continue
+		}
+		if out.fromRule != "" && out.fromRule != ruleName {
+			continue
+		}
+		for _, v := range chainValues(item[out.field]) {
+			out.send(v)
+		}
+	}
+}
+
+func (self *feed) send(v string) {
+	self.lock.Lock()
+	// 下游已结束（如OnStart失败）时丢弃取值，不再暂存
+	select {
+	case <-self.done:
+		self.lock.Unlock()
+		return
+	default:
+	}
+	if self.seen[v] {
+		self.lock.Unlock()
+		return
+	}
+	self.seen[v] = true
+	atomic.AddInt32(&self.pending, 1)
+	// 下游尚未启动（如并发数小于蜘蛛数，下游排在上游之后）时暂存，避免上游阻塞而下游无法启动
+	select {
+	case <-self.started:
+	default:
+		self.backlog = append(self.backlog, v)
+		self.lock.Unlock()
+		return
+	}
+	self.lock.Unlock()
+
+	select {
+	case self.ch <- v:
+	case <-self.done:
+		atomic.AddInt32(&self.pending, -1)
+	}
+}
+
+// senderDone 上游结束，全部上游结束后关闭通道
+func (self *feed) senderDone() {
+	if atomic.AddInt32(&self.senders, -1) == 0 {
+		close(self.ch)
+	}
+}
+
+// drained 全部上游已结束且取值已处理，或下游已不再接收
+func (self *feed) drained() bool {
+	select {
+	case <-self.done:
+		return true
+	default:
+	}
+	return atomic.LoadInt32(&self.senders) <= 0 && atomic.LoadInt32(&self.pending) == 0
+}
+
+func (self *feed) stop() {
+	self.once.Do(func() {
+		self.lock.Lock()
+		close(self.done)
+		atomic.AddInt32(&self.pending, -int32(len(self.backlog)))
+		self.backlog = nil
+		self.lock.Unlock()
+	})
+}
+
+// consumeFeeds 下游在Start时为每个通道启动处理协程，先处理启动前暂存的取值
+func (self *Spider) consumeFeeds() {
+	for _, f := range self.feedsIn {
+		f.lock.Lock()
+		backlog := f.backlog
+		f.backlog = nil
+		close(f.started)
+		f.lock.Unlock()
+		go func(f *feed) {
+			for _, v := range backlog {
+				self.consume(f, v)
+				atomic.AddInt32(&f.pending, -1)
+			}
+			for v := range f.ch {
+				self.consume(f, v)
+				atomic.AddInt32(&f.pending, -1)
+			}
+		}(f)
+	}
+}
+
+func (self *Spider) consume(f *feed, v string) {
+	defer func() {
+		if p := recover(); p != nil && p != FORCED_STOP {
+			logs.Log.Error(" *     Panic  [chain][%s][%s]: %v\n", self.GetName(), v, p)
+		}
+	}()
+	if self.IsStopping() {
+		return
+	}
+	ctx := GetContext(self, nil)
+	defer PutContext(ctx)
+	switch f.as {
+	case CHAIN_KEYIN:
+		ctx.keyin = v
+		if self.RuleTree.Root != nil {
+			self.RuleTree.Root(ctx)
+		}
+	case CHAIN_REQUEST:
+		ctx.AddQueue(&request.Request{Url: v, Rule: f.rule})
+	}
+}
+
+// chainsOpen 是否仍有上游未结束或取值未处理完
+func (self *Spider) chainsOpen() bool {
+	for _, f := range self.feedsIn {
+		if !f.drained() {
+			return true
+		}
+	}
+	return false
+}
+
+// keyinChained 以CHAIN_KEYIN方式接收上游取值时，不再以自身的Keyin执行Root
+func (self *Spider) keyinChained() bool {
+	for _, f := range self.feedsIn {
+		if f.as == CHAIN_KEYIN {
+			return true
+		}
+	}
+	return false
+}
+
+// closeFeeds 结束时通知下游，并使仍在向本蜘蛛发送的上游不再阻塞
+func (self *Spider) closeFeeds() {
+	for _, out := range self.feedsOut {
+		out.senderDone()
+	}
+	for _, f := range self.feedsIn {
+		f.stop()
+	}
+}
+
+func chainValues(v interface{}) []string {
+	var vs []string
+	switch v := v.(type) {
+	case nil:
+	case string:
+		vs = []string{v}
+	case []string:
+		vs = v
+	case []interface{}:
+		for _, e := range v {
+			vs = append(vs, chainValues(e)...)
+		}
+	case json.Number:
+		vs = []string{v.String()}
+	default:
+		vs = []string{fmt.Sprint(v)}
+	}
+	var out []string
+	for _, s := range vs {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
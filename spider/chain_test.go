@@ -0,0 +1,100 @@
+package spider
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go-spider/pipeline/collector/data"
+)
+
+func TestChainEmit(t *testing.T) {
+	up := &Spider{Name: "up", RuleTree: &RuleTree{Trunk: map[string]*Rule{"list": {}}}}
+	down := &Spider{Name: "down", RuleTree: &RuleTree{Trunk: map[string]*Rule{"detail": {}}}}
+	if err := up.ChainTo(down, "list", "id", CHAIN_REQUEST, "nosuch", 10); err == nil {
+		t.Fatal("expected an error for an unknown downstream rule")
+	}
+	if err := up.ChainTo(down, "list", "id", "", "", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": []interface{}{"a", " b ", "a"}}})
+	up.Emit(data.DataCell{"RuleName": "other", "Data": map[string]interface{}{"id": "c"}})
+	up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": "b"}})
+
+	f := down.feedsIn[0]
+	if !down.chainsOpen() {
+		t.Error("feed should stay open while the upstream runs")
+	}
+	up.closeFeeds()
+	var got []string
+	for v := range f.ch {
+		got = append(got, v)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestChainBacklog(t *testing.T) {
+	up := newTestSpider(nil)
+	down := newTestSpider(nil)
+	var (
+		lock   sync.Mutex
+		keyins []string
+	)
+	down.RuleTree.Root = func(ctx *Context) {
+		lock.Lock()
+		keyins = append(keyins, ctx.GetKeyin())
+		lock.Unlock()
+	}
+	if err := up.ChainTo(down, "", "id", CHAIN_KEYIN, "", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 下游未启动时，超出缓冲的取值不阻塞上游
+	done := make(chan struct{})
+	go func() {
+		for _, id := range []string{"a", "b", "c"} {
+			up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": id}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("upstream blocked before the downstream started")
+	}
+
+	down.consumeFeeds()
+	up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": "d"}})
+	up.closeFeeds()
+	for deadline := time.Now().Add(time.Second); down.chainsOpen(); {
+		if time.Now().After(deadline) {
+			t.Fatal("feed not drained")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(keyins, want) {
+		t.Errorf("got %v, want %v", keyins, want)
+	}
+}
+
+func TestChainStoppedBeforeStart(t *testing.T) {
+	up := newTestSpider(nil)
+	down := newTestSpider(nil)
+	if err := up.ChainTo(down, "", "id", CHAIN_KEYIN, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	f := down.feedsIn[0]
+	up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": "a"}})
+	// 下游未启动即结束（如OnStart失败）时清空暂存，之后的取值直接丢弃
+	down.closeFeeds()
+	up.Emit(data.DataCell{"RuleName": "list", "Data": map[string]interface{}{"id": "b"}})
+	if len(f.backlog) != 0 || f.pending != 0 {
+		t.Errorf("backlog = %v, pending = %d", f.backlog, f.pending)
+	}
+}
@@ -0,0 +1,103 @@
+package spider
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/saintfish/chardet"
+	"golang.org/x/net/html/charset"
+)
+
+// 字符集来源
+const (
+	CHARSET_BOM     = "bom"
+	CHARSET_HEADER  = "header"
+	CHARSET_META    = "meta"
+	CHARSET_DETECT  = "detect"
+	CHARSET_DEFAULT = "default"
+)
+
+const sniffLen = 4096
+
+var (
+	xmlDeclRegexp   = regexp.MustCompile(`(?i)^\s*<\?xml[^>]*?encoding\s*=\s*["']?\s*([\w.:-]+)`)
+	metaCharsetRe   = regexp.MustCompile(`(?i)<meta[^>]+?charset\s*=\s*["']?\s*([\w.:-]+)`)
+	charsetDetector = chardet.NewTextDetector()
+)
+
+// DetectCharset 依次通过BOM、Content-Type头（按先后传入）、HTML meta或XML声明、统计检测来判断正文字符集，
+// 返回规范化的字符集名称及其来源
+func DetectCharset(body []byte, contentTypes ...string) (name string, source string) {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xEF\xBB\xBF")):
+		return "utf-8", CHARSET_BOM
+	case bytes.HasPrefix(body, []byte("\xFE\xFF")):
+		return "utf-16be", CHARSET_BOM
+	case bytes.HasPrefix(body, []byte("\xFF\xFE")):
+		return "utf-16le", CHARSET_BOM
+	}
+
+	for _, contentType := range contentTypes {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			if name = normalizeCharset(params["charset"]); name != "" {
+				return name, CHARSET_HEADER
+			}
+		}
+	}
+
+	head := body
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if m := xmlDeclRegexp.FindSubmatch(head); m != nil {
+		if name = normalizeCharset(string(m[1])); name != "" {
+			return name, CHARSET_META
+		}
+	}
+	if m := metaCharsetRe.FindSubmatch(head); m != nil {
+		if name = normalizeCharset(string(m[1])); name != "" {
+			return name, CHARSET_META
+		}
+	}
+
+	if utf8.Valid(body) {
+		return "utf-8", CHARSET_DETECT
+	}
+	if r, err := charsetDetector.DetectBest(body); err == nil {
+		if name = normalizeCharset(r.Charset); name != "" {
+			return name, CHARSET_DETECT
+		}
+	}
+	return "utf-8", CHARSET_DEFAULT
+}
+
+// DecodeBody 将正文转码为UTF-8，无法转码时原样返回
+func DecodeBody(body []byte, name string) ([]byte, error) {
+	switch name {
+	case "utf-8":
+		return bytes.TrimPrefix(body, []byte("\xEF\xBB\xBF")), nil
+	}
+	enc, _ := charset.Lookup(name)
+	if enc == nil {
+		return body, nil
+	}
+	return enc.NewDecoder().Bytes(body)
+}
+
+// normalizeCharset 返回WHATWG规范名称，未知字符集返回空
+func normalizeCharset(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	switch label {
+	case "":
+		return ""
+	case "gb-18030":
+		label = "gb18030"
+	}
+	if _, name := charset.Lookup(label); name != "" {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package spider
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestDetectCharset(t *testing.T) {
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String(strings.Repeat("中文网页内容，字符集检测。", 20))
+	cases := []struct {
+		name         string
+		body         string
+		contentTypes []string
+		want, source string
+	}{
+		{"bom", "\xEF\xBB\xBFhello", []string{"text/html; charset=gbk"}, "utf-8", CHARSET_BOM},
+		{"response header", "<html></html>", []string{"text/html; charset=GB2312", ""}, "gbk", CHARSET_HEADER},
+		{"request header", "<html></html>", []string{"text/html", "application/x-www-form-urlencoded; charset=big5"}, "big5", CHARSET_HEADER},
+		{"meta", `<html><head><meta charset="shift_jis"></head></html>`, nil, "shift_jis", CHARSET_META},
+		{"http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=gb2312">`, nil, "gbk", CHARSET_META},
+		{"xml", `<?xml version="1.0" encoding="GB18030"?><rss></rss>`, nil, "gb18030", CHARSET_META},
+		{"utf-8", "<p>中文</p>", nil, "utf-8", CHARSET_DETECT},
+		{"gbk", "<p>" + gbk + "</p>", nil, "gb18030", CHARSET_DETECT},
+	}
+	for _, c := range cases {
+		name, source := DetectCharset([]byte(c.body), c.contentTypes...)
+		if name != c.want || source != c.source {
+			t.Errorf("%s: got %s (%s), want %s (%s)", c.name, name, source, c.want, c.source)
+		}
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("中文")
+	if b, err := DecodeBody([]byte(gbk), "gbk"); err != nil || string(b) != "中文" {
+		t.Errorf("gbk: got %q, %v", b, err)
+	}
+	if b, _ := DecodeBody([]byte("\xEF\xBB\xBF中文"), "utf-8"); string(b) != "中文" {
+		t.Errorf("utf-8 bom: got %q", b)
+	}
+}
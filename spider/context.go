@@ -2,16 +2,16 @@ package spider
 
 import (
 	"bytes"
-	"io"
 	"io/ioutil"
-	"mime"
 	"net/http"
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
-	"golang.org/x/net/html/charset"
+	"github.com/antchfx/xmlquery"
+	"go-spider/aid/domain"
 	"go-spider/downloader/request"
 	"go-spider/pipeline/collector/data"
 	"go-spider/common/goquery"
@@ -24,7 +24,15 @@ type Context struct {
 	Request  *request.Request  
 	Response *http.Response    
 	text     []byte            
+	charset  string
+	charsetSource string // 字符集的判断依据，见CHARSET_*
 	dom      *goquery.Document 
+	xmlDoc   *xmlquery.Node
+	jsonData   interface{}
+	jsonParsed bool
+	followed map[string]bool
+	keyin    string // 串联时由上游传入的自定义配置
+	feedOutput bool // 已输出详情请求携带的Feed条目
 	items    []data.DataCell   
 	files    []data.FileCell   
 	err      error             
@@ -59,7 +67,15 @@ func PutContext(ctx *Context) {
 	ctx.spider = nil
 	ctx.Request = nil
 	ctx.text = nil
+	ctx.charset = ""
+	ctx.charsetSource = ""
 	ctx.dom = nil
+	ctx.xmlDoc = nil
+	ctx.jsonData = nil
+	ctx.jsonParsed = false
+	ctx.followed = nil
+	ctx.keyin = ""
+	ctx.feedOutput = false
 	ctx.err = nil
 	contextPool.Put(ctx)
 }
@@ -78,6 +94,13 @@ func (self *Context) AddQueue(req *request.Request) *Context {
 	
 	self.spider.tryPanic()
 
+	if req.GetProfile() == "" {
+		req.SetProfile(self.spider.GetProfile())
+	}
+	if req.GetProxySession() == "" {
+		req.SetProxySession(self.spider.GetProxySession())
+	}
+	self.inheritKeyin(req)
 	err := req.
 		SetSpiderName(self.spider.GetName()).
 		SetEnableCookie(self.spider.GetEnableCookie()).
@@ -117,7 +140,25 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 		}
 	}
 	req.PostData, _ = jreq["PostData"].(string)
+	req.PostJson = jreq["PostJson"]
+	if b, ok := jreq["PostBytes"].(string); ok {
+		req.PostBytes = []byte(b)
+	}
+	switch files := jreq["PostFiles"].(type) {
+	case []map[string]interface{}:
+		for _, f := range files {
+			jsAddPostFile(req, f)
+		}
+	case []interface{}:
+		for _, f := range files {
+			if f, ok := f.(map[string]interface{}); ok {
+				jsAddPostFile(req, f)
+			}
+		}
+	}
 	req.Reloadable, _ = jreq["Reloadable"].(bool)
+	req.Profile, _ = jreq["Profile"].(string)
+	req.ProxySession, _ = jreq["ProxySession"].(string)
 	if t, ok := jreq["DialTimeout"].(int64); ok {
 		req.DialTimeout = time.Duration(t)
 	}
@@ -142,6 +183,13 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 	if t, ok := jreq["Temp"].(map[string]interface{}); ok {
 		req.Temp = t
 	}
+	if req.GetProfile() == "" {
+		req.SetProfile(self.spider.GetProfile())
+	}
+	if req.GetProxySession() == "" {
+		req.SetProxySession(self.spider.GetProxySession())
+	}
+	self.inheritKeyin(req)
 	err := req.
 		SetSpiderName(self.spider.GetName()).
 		SetEnableCookie(self.spider.GetEnableCookie()).
@@ -157,7 +205,35 @@ func (self *Context) JsAddQueue(jreq map[string]interface{}) *Context {
 	return self
 }
 
+// inheritKeyin 串联时使派生的请求沿用上游传入的自定义配置
+func (self *Context) inheritKeyin(req *request.Request) {
+	if !self.spider.keyinChained() {
+		return
+	}
+	keyin := self.GetKeyin()
+	if keyin == "" || (req.Temp != nil && req.Temp[CHAIN_KEYIN_TEMP] != nil) {
+		return
+	}
+	if req.Temp == nil {
+		req.Temp = make(request.Temp)
+	}
+	req.Temp[CHAIN_KEYIN_TEMP] = keyin
+}
+
+func jsAddPostFile(req *request.Request, f map[string]interface{}) {
+	field, _ := f["Field"].(string)
+	name, _ := f["Name"].(string)
+	contentType, _ := f["ContentType"].(string)
+	data, _ := f["Data"].(string)
+	req.AddPostFile(field, name, contentType, []byte(data))
+}
+
 func (self *Context) Output(item interface{}, ruleName ...string) {
+	self.output(item, ruleName...)
+}
+
+// output 返回数据是否通过校验并被接受
+func (self *Context) output(item interface{}, ruleName ...string) (accepted bool) {
 	_ruleName, rule, found := self.getRule(ruleName...)
 	if !found {
 		logs.Log.Error("蜘蛛 %s 调用Output()时，指定的规则名不存在", self.spider.GetName())
@@ -178,6 +254,33 @@ func (self *Context) Output(item interface{}, ruleName ...string) {
 		}
 		_item = item2
 	}
+	var err error
+	valid := _item
+	if len(rule.Processors) > 0 {
+		valid, err = rule.process(self, valid)
+	}
+	if err == nil && len(rule.Schema) > 0 {
+		valid, err = rule.validate(valid)
+	}
+	if err != nil {
+		rejected := make(map[string]interface{}, len(_item)+1)
+		for k, v := range _item {
+			rejected[k] = v
+		}
+		rejected[REJECT_REASON] = err.Error()
+		_item, _ruleName = rejected, _ruleName+REJECTS_SUFFIX
+		atomic.AddInt64(&self.spider.stat.rejects, 1)
+		logs.Log.Warning(" *     [%v] 数据未通过校验: %v\n", self.GetUrl(), err)
+	} else {
+		if _item = self.onItem(_ruleName, valid); _item == nil {
+			return
+		}
+		atomic.AddInt64(&self.spider.stat.items, 1)
+		accepted = true
+	}
+	if rule, ok := self.spider.GetRule(_ruleName); ok {
+		atomic.AddInt64(&rule.items, 1)
+	}
 	self.Lock()
 	if self.spider.NotDefaultField {
 		self.items = append(self.items, data.GetDataCell(_ruleName, _item, "", "", ""))
@@ -185,6 +288,7 @@ func (self *Context) Output(item interface{}, ruleName ...string) {
 		self.items = append(self.items, data.GetDataCell(_ruleName, _item, self.GetUrl(), self.GetReferer(), time.Now().Format("2006-01-02 15:04:05")))
 	}
 	self.Unlock()
+	return
 }
 
 func (self *Context) FileOutput(nameOrExt ...string) {
@@ -217,6 +321,7 @@ func (self *Context) FileOutput(nameOrExt ...string) {
 	self.Lock()
 	self.files = append(self.files, data.GetFileCell(self.GetRuleName(), baseName+ext, bytes))
 	self.Unlock()
+	atomic.AddInt64(&self.spider.stat.files, 1)
 }
 
 func (self *Context) CreatItem(item map[int]interface{}, ruleName ...string) map[string]interface{} {
@@ -282,7 +387,9 @@ func (self *Context) Parse(ruleName ...string) *Context {
 		self.Request.SetRuleName(_ruleName)
 	}
 	if !found {
-		self.spider.RuleTree.Root(self)
+		if self.spider.RuleTree.Root != nil {
+			self.spider.RuleTree.Root(self)
+		}
 		return self
 	}
 	if rule.ParseFunc == nil {
@@ -290,6 +397,7 @@ func (self *Context) Parse(ruleName ...string) *Context {
 		return self
 	}
 	rule.ParseFunc(self)
+	self.outputFeedDetail()
 	return self
 }
 
@@ -316,11 +424,15 @@ func (self *Context) RunTimer(id string) bool {
 	return self.spider.RunTimer(id)
 }
 
+// ResetText 替换正文，并清空由正文解析出的DOM、XML与JSON缓存
 func (self *Context) ResetText(body string) *Context {
 	x := (*[2]uintptr)(unsafe.Pointer(&body))
 	h := [3]uintptr{x[0], x[1], x[1]}
 	self.text = *(*[]byte)(unsafe.Pointer(&h))
 	self.dom = nil
+	self.xmlDoc = nil
+	self.jsonData = nil
+	self.jsonParsed = false
 	return self
 }
 
@@ -397,7 +509,16 @@ func (self *Context) PullFiles() (fs []data.FileCell) {
 	return
 }
 
+// GetKeyin 串联时返回上游传入的自定义配置，否则返回蜘蛛的自定义配置
 func (self *Context) GetKeyin() string {
+	if self.keyin != "" {
+		return self.keyin
+	}
+	if self.Request != nil {
+		if k, _ := self.Request.GetTemp(CHAIN_KEYIN_TEMP, "").(string); k != "" {
+			return k
+		}
+	}
 	return self.spider.GetKeyin()
 }
 
@@ -449,6 +570,11 @@ func (self *Context) GetHost() string {
 	return self.Response.Request.URL.Host
 }
 
+// GetDomain 返回响应所属的可注册域名，如 www.example.co.uk 为 example.co.uk
+func (self *Context) GetDomain() string {
+	return domain.Registrable(self.GetHost())
+}
+
 func (self *Context) GetHeader() http.Header {
 	return self.Response.Header
 }
@@ -479,6 +605,27 @@ func (self *Context) GetText() string {
 	return util.Bytes2String(self.text)
 }
 
+// IsSessionRenewed 会话绑定的代理IP是否刚被更换，为true时通常需要重新登录
+func (self *Context) IsSessionRenewed() bool {
+	return self.Request.IsSessionRenewed()
+}
+
+// GetCharset 返回正文转码前的字符集
+func (self *Context) GetCharset() string {
+	if self.text == nil {
+		self.initText()
+	}
+	return self.charset
+}
+
+// GetCharsetSource 返回字符集的判断依据（CHARSET_BOM、CHARSET_HEADER等），用于排查误判
+func (self *Context) GetCharsetSource() string {
+	if self.text == nil {
+		self.initText()
+	}
+	return self.charsetSource
+}
+
 func (self *Context) getRule(ruleName ...string) (name string, rule *Rule, found bool) {
 	if len(ruleName) == 0 {
 		if self.Response == nil {
@@ -505,50 +652,23 @@ func (self *Context) initDom() *goquery.Document {
 }
 
 func (self *Context) initText() {
-	var err error
-	if self.Request.DownloaderID == request.SURF_ID {
-		var contentType, pageEncode string
-		contentType = self.Response.Header.Get("Content-Type")
-		if _, params, err := mime.ParseMediaType(contentType); err == nil {
-			if cs, ok := params["charset"]; ok {
-				pageEncode = strings.ToLower(strings.TrimSpace(cs))
-			}
-		}
-		if len(pageEncode) == 0 {
-			contentType = self.Request.Header.Get("Content-Type")
-			if _, params, err := mime.ParseMediaType(contentType); err == nil {
-				if cs, ok := params["charset"]; ok {
-					pageEncode = strings.ToLower(strings.TrimSpace(cs))
-				}
-			}
-		}
-		switch pageEncode {
-		case "utf8", "utf-8", "unicode-1-1-utf-8":
-		default:
-			var destReader io.Reader
-			if len(pageEncode) == 0 {
-				destReader, err = charset.NewReader(self.Response.Body, "")
-			} else {
-				destReader, err = charset.NewReaderLabel(pageEncode, self.Response.Body)
-			}
-			if err == nil {
-				self.text, err = ioutil.ReadAll(destReader)
-				if err == nil {
-					self.Response.Body.Close()
-					return
-				} else {
-					logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
-				}
-			} else {
-				logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
-			}
-		}
-	}
-	
-	self.text, err = ioutil.ReadAll(self.Response.Body)
+	body, err := ioutil.ReadAll(self.Response.Body)
 	self.Response.Body.Close()
 	if err != nil {
 		panic(err.Error())
 		return
 	}
-}
\ No newline at end of file
+	var reqContentType string
+	if self.Request.Header != nil {
+		reqContentType = self.Request.Header.Get("Content-Type")
+	}
+	self.charset, self.charsetSource = DetectCharset(body, self.Response.Header.Get("Content-Type"), reqContentType)
+	if self.charsetSource == CHARSET_DETECT || self.charsetSource == CHARSET_DEFAULT {
+		logs.Log.Debug(" *     [charset][%v]: %s (%s)\n", self.GetUrl(), self.charset, self.charsetSource)
+	}
+	self.text, err = DecodeBody(body, self.charset)
+	if err != nil {
+		logs.Log.Warning(" *     [convert][%v]: %v (ignore transcoding)\n", self.GetUrl(), err)
+		self.text = body
+	}
+}
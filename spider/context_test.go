@@ -0,0 +1,55 @@
+package spider
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/runtime/status"
+)
+
+// newTestSpider 返回处于运行状态的蜘蛛，可直接加入请求与输出数据
+func newTestSpider(rules map[string]*Rule) *Spider {
+	if rules == nil {
+		rules = map[string]*Rule{}
+	}
+	return &Spider{Name: "test", RuleTree: &RuleTree{Trunk: rules}, status: status.RUN}
+}
+
+// newTestContext 返回已设置响应的Context，rawurl同时作为最终链接
+func newTestContext(sp *Spider, rawurl, contentType, body string) *Context {
+	if sp == nil {
+		sp = newTestSpider(nil)
+	}
+	req := &request.Request{Url: rawurl, Rule: "test"}
+	req.Prepare()
+	u, _ := url.Parse(rawurl)
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    &http.Request{Method: "GET", URL: u, Header: make(http.Header)},
+	}
+	return GetContext(sp, req).SetResponse(resp)
+}
+
+func TestContextCharsetSource(t *testing.T) {
+	ctx := newTestContext(nil, "http://example.com/", "text/html; charset=gb2312", "<p>a</p>")
+	defer PutContext(ctx)
+	if ctx.GetCharset() != "gbk" || ctx.GetCharsetSource() != CHARSET_HEADER {
+		t.Errorf("got %s (%s)", ctx.GetCharset(), ctx.GetCharsetSource())
+	}
+
+	ctx2 := newTestContext(nil, "http://example.com/", "text/html", "<p>a</p>")
+	defer PutContext(ctx2)
+	if ctx2.GetCharset() != "utf-8" || ctx2.GetCharsetSource() != CHARSET_DETECT {
+		t.Errorf("got %s (%s)", ctx2.GetCharset(), ctx2.GetCharsetSource())
+	}
+}
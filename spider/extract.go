@@ -0,0 +1,166 @@
+package spider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+
+	"go-spider/common/goquery"
+	"go-spider/downloader/request"
+)
+
+type (
+	// extractor 由RuleModle中的Items与Field声明编译而成的抽取规则
+	extractor struct {
+		items  *selector
+		fields []*fieldExtractor
+	}
+	fieldExtractor struct {
+		FieldModle
+		sel   *selector
+		regex *regexp.Regexp
+	}
+	selector struct {
+		css   string
+		xpath *xpath.Expr
+	}
+)
+
+func newExtractor(m RuleModle) (*extractor, error) {
+	ex := &extractor{}
+	var err error
+	if ex.items, err = newSelector(m.Items.Css, m.Items.Xpath); err != nil {
+		return nil, fmt.Errorf("rule %s: Items: %v", m.Name, err)
+	}
+	for _, f := range m.Fields {
+		fe := &fieldExtractor{FieldModle: f}
+		if fe.sel, err = newSelector(f.Css, f.Xpath); err != nil {
+			return nil, fmt.Errorf("rule %s: Field %s: %v", m.Name, f.Name, err)
+		}
+		if f.Regex != "" {
+			if fe.regex, err = regexp.Compile(f.Regex); err != nil {
+				return nil, fmt.Errorf("rule %s: Field %s: %v", m.Name, f.Name, err)
+			}
+		}
+		if f.Name == "" && f.Follow == "" {
+			return nil, fmt.Errorf("rule %s: Field needs a name or a follow rule", m.Name)
+		}
+		ex.fields = append(ex.fields, fe)
+	}
+	return ex, nil
+}
+
+// newSelector css与xpath均为空时返回nil，表示当前节点本身
+func newSelector(css, xpathExpr string) (*selector, error) {
+	switch {
+	case css != "" && xpathExpr != "":
+		return nil, fmt.Errorf("css and xpath are mutually exclusive")
+	case css != "":
+		return &selector{css: css}, nil
+	case xpathExpr != "":
+		expr, err := xpath.Compile(xpathExpr)
+		if err != nil {
+			return nil, fmt.Errorf("xpath %q: %v", xpathExpr, err)
+		}
+		return &selector{xpath: expr}, nil
+	}
+	return nil, nil
+}
+
+func (self *selector) find(node *html.Node) []*html.Node {
+	if self == nil {
+		return []*html.Node{node}
+	}
+	if self.xpath != nil {
+		return htmlquery.QuerySelectorAll(node, self.xpath)
+	}
+	return goquery.NewDocumentFromNode(node).Find(self.css).Nodes
+}
+
+// names 返回输出字段名，按声明顺序
+func (self *extractor) names() []string {
+	var names []string
+	for _, f := range self.fields {
+		if f.Name != "" {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// run 在每个Items节点（未声明时为整个页面）内抽取字段，输出非空的结果并将follow字段的链接加入队列
+func (self *extractor) run(ctx *Context, root *html.Node) {
+	base := baseURL(ctx.GetDom(), ctx.finalURL())
+	for _, scope := range self.items.find(root) {
+		item := make(map[string]interface{}, len(self.fields))
+		var found bool
+		for _, f := range self.fields {
+			values := f.extract(scope)
+			if f.Follow != "" {
+				for _, v := range values {
+					if link := resolveLink(base, v); link != "" {
+						ctx.AddQueue(&request.Request{Url: link, Rule: f.Follow})
+					}
+				}
+			}
+			if f.Name == "" {
+				continue
+			}
+			if len(values) > 0 {
+				found = true
+			}
+			if f.Multiple {
+				item[f.Name] = values
+			} else if len(values) > 0 {
+				item[f.Name] = values[0]
+			} else {
+				item[f.Name] = ""
+			}
+		}
+		if found {
+			ctx.Output(item)
+		}
+	}
+}
+
+func (self *fieldExtractor) extract(scope *html.Node) []string {
+	var values []string
+	for _, node := range self.sel.find(scope) {
+		v := nodeValue(node, self.Attr)
+		if self.regex != nil {
+			m := self.regex.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+			v = m[0]
+			if len(m) > 1 {
+				v = m[1]
+			}
+		}
+		if v == "" {
+			continue
+		}
+		values = append(values, v)
+		if !self.Multiple && self.Follow == "" {
+			break
+		}
+	}
+	return values
+}
+
+// nodeValue attr为空或text时取文本（xpath选中属性节点时即属性值），html取内部HTML，outerhtml取含自身的HTML，其余视为属性名
+func nodeValue(node *html.Node, attr string) string {
+	switch strings.ToLower(attr) {
+	case "", "text":
+		return strings.TrimSpace(htmlquery.InnerText(node))
+	case "html":
+		return htmlquery.OutputHTML(node, false)
+	case "outerhtml":
+		return htmlquery.OutputHTML(node, true)
+	}
+	return strings.TrimSpace(htmlquery.SelectAttr(node, attr))
+}
@@ -0,0 +1,131 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+
+	"go-spider/downloader/request"
+)
+
+const extractFixture = `<html><body>
+<ul id="list">
+  <li class="item"><a href="/a/1">First</a><span class="price">￥12.50</span><img src="1.jpg"><img src="1b.jpg"></li>
+  <li class="item"><a href="/a/2">Second</a><span class="price">￥8</span><img src="2.jpg"></li>
+  <li class="item"><span class="price">none</span></li>
+</ul>
+<div class="pager"><a href="?page=2">next</a></div>
+<p id="intro"><b>Hello</b> world</p>
+</body></html>`
+
+// runExtractor 以规则test在fixture页面上运行m，返回输出的数据与加入队列的请求
+func runExtractor(t *testing.T, m RuleModle) ([]map[string]interface{}, []*request.Request) {
+	ex, err := newExtractor(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []*request.Request
+	sp := newTestSpider(map[string]*Rule{"test": {ItemFields: ex.names()}})
+	sp.CatchRequests(func(req *request.Request) { reqs = append(reqs, req) })
+	ctx := newTestContext(sp, "http://example.com/shop/list.html", "text/html; charset=utf-8", extractFixture)
+	defer PutContext(ctx)
+
+	ex.run(ctx, ctx.htmlRoot())
+	var items []map[string]interface{}
+	for _, cell := range ctx.PullItems() {
+		items = append(items, cell["Data"].(map[string]interface{}))
+	}
+	return items, reqs
+}
+
+func TestExtractSelectors(t *testing.T) {
+	items, _ := runExtractor(t, RuleModle{Name: "test", Fields: []FieldModle{
+		{Name: "css", Css: "#intro b"},
+		{Name: "xpath", Xpath: `//p[@id="intro"]`},
+		{Name: "attr", Css: "#list a", Attr: "href"},
+		{Name: "xattr", Xpath: `//li[2]/img/@src`},
+		{Name: "html", Css: "#intro", Attr: "html"},
+		{Name: "outer", Css: "#intro b", Attr: "outerhtml"},
+		{Name: "missing", Css: ".nothing"},
+	}})
+	want := []map[string]interface{}{{
+		"css":     "Hello",
+		"xpath":   "Hello world",
+		"attr":    "/a/1",
+		"xattr":   "2.jpg",
+		"html":    "<b>Hello</b> world",
+		"outer":   "<b>Hello</b>",
+		"missing": "",
+	}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+}
+
+func TestExtractListAndRegex(t *testing.T) {
+	items, _ := runExtractor(t, RuleModle{Name: "test", Fields: []FieldModle{
+		{Name: "titles", Css: "#list a", Multiple: true},
+		{Name: "prices", Css: ".price", Regex: `([\d.]+)`, Multiple: true},
+		{Name: "first", Css: ".price", Regex: `[\d.]+`},
+	}})
+	want := []map[string]interface{}{{
+		"titles": []string{"First", "Second"},
+		"prices": []string{"12.50", "8"},
+		"first":  "12.50",
+	}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+}
+
+func TestExtractItems(t *testing.T) {
+	items, reqs := runExtractor(t, RuleModle{
+		Name:  "test",
+		Items: ItemsModle{Css: "li.item"},
+		Fields: []FieldModle{
+			{Name: "title", Css: "a"},
+			{Name: "url", Css: "a", Attr: "href", Follow: "detail"},
+			{Name: "images", Xpath: ".//img/@src", Multiple: true},
+		},
+	})
+	want := []map[string]interface{}{
+		{"title": "First", "url": "/a/1", "images": []string{"1.jpg", "1b.jpg"}},
+		{"title": "Second", "url": "/a/2", "images": []string{"2.jpg"}},
+	}
+	// 第三项所有字段均为空，不输出
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+	if len(reqs) != 2 || reqs[0].GetUrl() != "http://example.com/a/1" || reqs[1].GetUrl() != "http://example.com/a/2" {
+		t.Fatalf("got requests %v", reqs)
+	}
+	if reqs[0].GetRuleName() != "detail" {
+		t.Errorf("follow rule = %q", reqs[0].GetRuleName())
+	}
+}
+
+func TestExtractFollowOnly(t *testing.T) {
+	items, reqs := runExtractor(t, RuleModle{Name: "test", Fields: []FieldModle{
+		{Css: ".pager a", Attr: "href", Follow: "test"},
+	}})
+	if len(items) != 0 {
+		t.Errorf("follow-only field produced items: %v", items)
+	}
+	if len(reqs) != 1 || reqs[0].GetUrl() != "http://example.com/shop/list.html?page=2" {
+		t.Errorf("got requests %v", reqs)
+	}
+}
+
+func TestNewExtractorErrors(t *testing.T) {
+	cases := map[string]RuleModle{
+		"css and xpath": {Fields: []FieldModle{{Name: "a", Css: "a", Xpath: "//a"}}},
+		"bad xpath":     {Fields: []FieldModle{{Name: "a", Xpath: "//a["}}},
+		"bad regex":     {Fields: []FieldModle{{Name: "a", Css: "a", Regex: "("}}},
+		"no name":       {Fields: []FieldModle{{Css: "a"}}},
+		"bad items":     {Items: ItemsModle{Css: "li", Xpath: "//li"}},
+	}
+	for name, m := range cases {
+		if _, err := newExtractor(m); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
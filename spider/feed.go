@@ -0,0 +1,217 @@
+package spider
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"go-spider/downloader/request"
+	"go-spider/logs"
+)
+
+// Feed规则输出的字段
+const (
+	FEED_TITLE     = "title"
+	FEED_LINK      = "link"
+	FEED_PUBLISHED = "published"
+	FEED_AUTHOR    = "author"
+	FEED_SUMMARY   = "summary"
+	FEED_GUID      = "guid"
+)
+
+// 详情请求的Temp中记录条目的GUID与Feed规则名，详情解析成功后才以Feed规则输出条目并记入抓取历史
+const (
+	FEED_SEEN_TEMP = "__feed_guid__"
+	FEED_RULE_TEMP = "__feed_rule__"
+)
+
+var feedFields = []string{FEED_TITLE, FEED_LINK, FEED_PUBLISHED, FEED_AUTHOR, FEED_SUMMARY, FEED_GUID}
+
+// 发布时间依次尝试的格式，均失败时再尝试TimeLayouts
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+}
+
+type (
+	feedDoc struct {
+		Channel struct {
+			Items []feedEntry `xml:"item"`
+		} `xml:"channel"` // RSS 2.0
+		Items   []feedEntry `xml:"item"`  // RDF (RSS 1.0)
+		Entries []feedEntry `xml:"entry"` // Atom
+	}
+	feedEntry struct {
+		Title       string     `xml:"title"`
+		Links       []feedLink `xml:"link"`
+		PubDate     string     `xml:"pubDate"`
+		Published   string     `xml:"published"`
+		Updated     string     `xml:"updated"`
+		Date        string     `xml:"http://purl.org/dc/elements/1.1/ date"`
+		Author      feedAuthor `xml:"author"`
+		Creator     string     `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Description string     `xml:"description"`
+		Summary     string     `xml:"summary"`
+		Content     string     `xml:"content"`
+		GUID        string     `xml:"guid"`
+		ID          string     `xml:"id"`
+		About       string     `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	}
+	feedLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	}
+	feedAuthor struct {
+		Text string `xml:",chardata"`
+		Name string `xml:"name"`
+	}
+)
+
+// NewFeedRule 返回解析RSS 2.0、Atom与RDF的规则，输出标准化的条目；
+// 以GUID（缺失时为链接）借助抓取历史跨批次去重，条目被接受后才记为已抓取；
+// detail非空时将条目链接以该规则加入队列，条目作为Temp传递，详情解析成功后才输出
+func NewFeedRule(detail string) *Rule {
+	return &Rule{
+		ItemFields: append([]string(nil), feedFields...),
+		ParseFunc: func(ctx *Context) {
+			ctx.ParseFeed(detail)
+		},
+	}
+}
+
+// ParseFeed 将当前响应按Feed解析，返回新条目的数量；
+// detail非空时有链接的条目随详情请求传递，由详情解析成功后输出，否则立即输出
+func (self *Context) ParseFeed(detail string) int {
+	entries, err := decodeFeed([]byte(self.GetText()))
+	if err != nil {
+		logs.Log.Error(" *     Feed [%v]: %v\n", self.GetUrl(), err)
+		return 0
+	}
+	var n int
+	for _, e := range entries {
+		item := e.normalize()
+		guid, _ := item[FEED_GUID].(string)
+		if guid == "" || self.spider.Seen(feedSeenKey(guid)) {
+			continue
+		}
+		link, _ := item[FEED_LINK].(string)
+		if detail == "" || link == "" {
+			// 未通过校验或被OnItem丢弃的条目不记为已抓取，下次仍会尝试
+			if self.output(item) {
+				self.spider.MarkSeen(feedSeenKey(guid))
+				n++
+			}
+			continue
+		}
+		temp := make(request.Temp, len(item)+2)
+		for k, v := range item {
+			temp[k] = v
+		}
+		temp[FEED_SEEN_TEMP] = guid
+		temp[FEED_RULE_TEMP] = self.GetRuleName()
+		self.AddQueue(&request.Request{
+			Url:  link,
+			Rule: detail,
+			Temp: temp,
+		})
+		n++
+	}
+	return n
+}
+
+func feedSeenKey(guid string) string {
+	return "feed:" + guid
+}
+
+// outputFeedDetail 详情规则解析完成后，以Feed规则输出Temp中的条目，被接受后记为已抓取
+func (self *Context) outputFeedDetail() {
+	guid, _ := self.GetTemp(FEED_SEEN_TEMP, "").(string)
+	rule, _ := self.GetTemp(FEED_RULE_TEMP, "").(string)
+	if guid == "" || rule == "" || self.feedOutput {
+		return
+	}
+	self.feedOutput = true
+	item := make(map[string]interface{}, len(feedFields))
+	for _, k := range feedFields {
+		item[k] = self.GetTemp(k, "")
+	}
+	if self.output(item, rule) {
+		self.spider.MarkSeen(feedSeenKey(guid))
+	}
+}
+
+func decodeFeed(body []byte) ([]feedEntry, error) {
+	// 正文已转码为UTF-8
+	body = xmlEncodingRegexp.ReplaceAll(body, []byte("$1"))
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	doc := &feedDoc{}
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+	entries := doc.Channel.Items
+	entries = append(entries, doc.Items...)
+	return append(entries, doc.Entries...), nil
+}
+
+func (self feedEntry) normalize() map[string]interface{} {
+	link := self.link()
+	guid := firstNonEmpty(self.GUID, self.ID, self.About, link)
+	return map[string]interface{}{
+		FEED_TITLE:     strings.TrimSpace(self.Title),
+		FEED_LINK:      link,
+		FEED_PUBLISHED: feedTime(firstNonEmpty(self.PubDate, self.Published, self.Date, self.Updated)),
+		FEED_AUTHOR:    firstNonEmpty(self.Author.Name, self.Author.Text, self.Creator),
+		FEED_SUMMARY:   firstNonEmpty(self.Description, self.Summary, self.Content),
+		FEED_GUID:      guid,
+	}
+}
+
+// link RSS取<link>的文本，Atom取rel为空或alternate的href
+func (self feedEntry) link() string {
+	for _, l := range self.Links {
+		if t := strings.TrimSpace(l.Text); t != "" {
+			return t
+		}
+	}
+	for _, l := range self.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// feedTime 统一为TIME_LAYOUT格式，无法解析时原样返回
+func feedTime(s string) string {
+	if s == "" {
+		return ""
+	}
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Local().Format(TIME_LAYOUT)
+		}
+	}
+	if t, err := (&SchemaField{}).toTime(s); err == nil {
+		return t.Format(TIME_LAYOUT)
+	}
+	return s
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, s := range strs {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
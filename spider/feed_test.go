@@ -0,0 +1,121 @@
+package spider
+
+import (
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/pipeline/collector/data"
+	"go-spider/runtime/cache"
+	"go-spider/runtime/status"
+)
+
+func TestDecodeFeed(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		want map[string]interface{}
+	}{
+		"rss": {
+			body: `<?xml version="1.0" encoding="GBK"?><rss version="2.0"><channel><title>News</title>
+<item><title> Hello </title><link>http://example.com/1</link><guid>g1</guid>
+<pubDate>Thu, 02 Jan 2020 15:04:05 +0000</pubDate><author>bob</author><description>&lt;b&gt;hi&lt;/b&gt;&nbsp;</description></item>
+</channel></rss>`,
+			want: map[string]interface{}{FEED_TITLE: "Hello", FEED_LINK: "http://example.com/1", FEED_GUID: "g1", FEED_AUTHOR: "bob", FEED_SUMMARY: "<b>hi</b>"},
+		},
+		"atom": {
+			body: `<feed xmlns="http://www.w3.org/2005/Atom"><entry><title>A</title>
+<link rel="self" href="http://example.com/self"/><link href="http://example.com/a"/>
+<id>urn:a</id><updated>2020-01-02T15:04:05Z</updated><author><name>amy</name></author><summary>s</summary></entry></feed>`,
+			want: map[string]interface{}{FEED_TITLE: "A", FEED_LINK: "http://example.com/a", FEED_GUID: "urn:a", FEED_AUTHOR: "amy", FEED_SUMMARY: "s"},
+		},
+		"rdf": {
+			body: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<item rdf:about="http://example.com/r"><title>R</title><link>http://example.com/r</link><dc:creator>rob</dc:creator><dc:date>2020-01-02</dc:date></item></rdf:RDF>`,
+			want: map[string]interface{}{FEED_TITLE: "R", FEED_LINK: "http://example.com/r", FEED_GUID: "http://example.com/r", FEED_AUTHOR: "rob"},
+		},
+	} {
+		entries, err := decodeFeed([]byte(tc.body))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("%s: got %d entries", name, len(entries))
+		}
+		item := entries[0].normalize()
+		for k, v := range tc.want {
+			if item[k] != v {
+				t.Errorf("%s: %s = %q, want %q", name, k, item[k], v)
+			}
+		}
+		if item[FEED_PUBLISHED] == "" {
+			t.Errorf("%s: published is empty", name)
+		}
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	// 服务端模式下调度不读取历史记录
+	mode := cache.Task.Mode
+	cache.Task.Mode = status.SERVER
+	defer func() { cache.Task.Mode = mode }()
+
+	var detailed bool
+	sp := newTestSpider(map[string]*Rule{
+		"test":   NewFeedRule("detail"),
+		"detail": {ParseFunc: func(ctx *Context) { detailed = true }},
+	})
+	sp.OnItem = func(ctx *Context, rule string, item map[string]interface{}) map[string]interface{} {
+		if item[FEED_TITLE] == "drop" {
+			return nil
+		}
+		return item
+	}
+	sp.ReqmatrixInit()
+	var reqs []*request.Request
+	sp.CatchRequests(func(req *request.Request) { reqs = append(reqs, req) })
+	ctx := newTestContext(sp, "http://example.com/rss", "application/rss+xml; charset=utf-8", `<rss><channel>
+<item><title>a</title><link>http://example.com/1</link><guid>g1</guid></item>
+<item><title>drop</title><guid>g2</guid></item>
+<item><title>c</title><guid>g3</guid></item>
+</channel></rss>`)
+	defer PutContext(ctx)
+	ctx.Request.SetRuleName("test")
+
+	if n := ctx.ParseFeed("detail"); n != 2 {
+		t.Errorf("got %d new entries, want 2", n)
+	}
+	// 有链接的条目随详情请求传递，不立即输出
+	if items := ctx.PullItems(); len(items) != 1 || feedItem(items[0])[FEED_TITLE] != "c" {
+		t.Errorf("got items %v", items)
+	}
+	// 被丢弃的条目不记为已抓取
+	if !sp.Seen(feedSeenKey("g3")) || sp.Seen(feedSeenKey("g1")) || sp.Seen(feedSeenKey("g2")) {
+		t.Error("only the accepted entry should be seen")
+	}
+	if len(reqs) != 1 || reqs[0].GetUrl() != "http://example.com/1" {
+		t.Fatalf("got requests %v", reqs)
+	}
+	if guid := reqs[0].GetTemp(FEED_SEEN_TEMP, ""); guid != "g1" {
+		t.Errorf("detail request guid = %v", guid)
+	}
+
+	// 详情解析成功后以Feed规则输出条目并记为已抓取
+	detail := newTestContext(sp, "http://example.com/1", "text/html", "<html></html>")
+	defer PutContext(detail)
+	detail.Request.Temp = reqs[0].Temp
+	detail.Parse("detail")
+	items := detail.PullItems()
+	if !detailed || len(items) != 1 || items[0]["RuleName"] != "test" || feedItem(items[0])[FEED_TITLE] != "a" {
+		t.Fatalf("got items %v", items)
+	}
+	if _, ok := feedItem(items[0])[FEED_SEEN_TEMP]; ok {
+		t.Error("internal temp leaked into the item")
+	}
+	if !sp.Seen(feedSeenKey("g1")) {
+		t.Error("entry not seen after its detail was parsed")
+	}
+}
+
+func feedItem(cell data.DataCell) map[string]interface{} {
+	item, _ := cell["Data"].(map[string]interface{})
+	return item
+}
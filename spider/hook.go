@@ -0,0 +1,112 @@
+package spider
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go-spider/downloader/request"
+	"go-spider/logs"
+)
+
+type (
+	// SpiderStat 蜘蛛本次运行的计数
+	SpiderStat struct {
+		Success int64            // 成功的请求数
+		Failure int64            // 失败的请求数（含重试）
+		Items   int64            // 输出的数据条数，不含未通过校验的
+		Rejects int64            // 未通过校验的数据条数
+		Files   int64            // 输出的文件数
+		Rules   map[string]int64 // 各规则输出的数据条数，未通过校验的计入"规则名__rejects"
+		Time    time.Duration
+	}
+	spiderStat struct {
+		success, failure, items, rejects, files int64
+		start                                   time.Time
+	}
+)
+
+// Stat 返回当前的计数
+func (self *Spider) Stat() SpiderStat {
+	s := SpiderStat{
+		Success: atomic.LoadInt64(&self.stat.success),
+		Failure: atomic.LoadInt64(&self.stat.failure),
+		Items:   atomic.LoadInt64(&self.stat.items),
+		Rejects: atomic.LoadInt64(&self.stat.rejects),
+		Files:   atomic.LoadInt64(&self.stat.files),
+		Rules:   make(map[string]int64),
+	}
+	if self.RuleTree != nil {
+		for name, rule := range self.RuleTree.Trunk {
+			if n := atomic.LoadInt64(&rule.items); n > 0 {
+				s.Rules[name] = n
+			}
+		}
+	}
+	if !self.stat.start.IsZero() {
+		s.Time = time.Since(self.stat.start)
+	}
+	return s
+}
+
+// RequestSucceeded 由crawler在请求处理成功后调用
+func (self *Spider) RequestSucceeded(req *request.Request) {
+	atomic.AddInt64(&self.stat.success, 1)
+}
+
+// RequestFailed 由crawler在请求失败后调用，并执行OnError
+func (self *Spider) RequestFailed(req *request.Request, err error) {
+	atomic.AddInt64(&self.stat.failure, 1)
+	self.robotsFailed(req)
+	if self.OnError == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			logs.Log.Error(" *     Panic  [OnError][%s]: %v\n", self.GetName(), p)
+		}
+	}()
+	self.OnError(self, req, err)
+}
+
+// onStart 返回false时不再执行Root
+func (self *Spider) onStart(ctx *Context) bool {
+	self.stat.start = time.Now()
+	if self.OnStart == nil {
+		return true
+	}
+	if err := self.OnStart(ctx); err != nil {
+		logs.Log.Error(" *     蜘蛛 %s 的OnStart返回错误，不再执行Root: %v\n", self.GetName(), err)
+		// 不再接收上游的取值
+		for _, f := range self.feedsIn {
+			f.stop()
+		}
+		return false
+	}
+	return true
+}
+
+func (self *Spider) onFinish() {
+	if self.OnFinish == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			logs.Log.Error(" *     Panic  [OnFinish][%s]: %v\n", self.GetName(), p)
+		}
+	}()
+	self.OnFinish(self, self.Stat())
+}
+
+// onItem 返回nil时丢弃该条数据
+func (self *Context) onItem(ruleName string, item map[string]interface{}) (out map[string]interface{}) {
+	if self.spider.OnItem == nil {
+		return item
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			logs.Log.Error(" *     Panic  [OnItem][%s]: %v\n", self.spider.GetName(), p)
+			out = item
+		}
+	}()
+	return self.spider.OnItem(self, ruleName, item)
+}
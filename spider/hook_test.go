@@ -0,0 +1,147 @@
+package spider
+
+import (
+	"errors"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/runtime/status"
+	"go-spider/scheduler"
+)
+
+func TestOnItem(t *testing.T) {
+	sp := &Spider{
+		Name:            "hooks",
+		NotDefaultField: true,
+		RuleTree:        &RuleTree{Trunk: map[string]*Rule{"item": {}}},
+		OnItem: func(ctx *Context, ruleName string, item map[string]interface{}) map[string]interface{} {
+			if item["drop"] == true {
+				return nil
+			}
+			item["seen"] = ruleName
+			return item
+		},
+	}
+	ctx := GetContext(sp, &request.Request{Url: "http://example.com/", Rule: "item"})
+	defer PutContext(ctx)
+	ctx.Output(map[string]interface{}{"title": "a"})
+	ctx.Output(map[string]interface{}{"title": "b", "drop": true})
+
+	items := ctx.PullItems()
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if got := items[0]["Data"].(map[string]interface{})["seen"]; got != "item" {
+		t.Errorf("seen = %v", got)
+	}
+	if stat := sp.Stat(); stat.Items != 1 {
+		t.Errorf("stat.Items = %d, want 1", stat.Items)
+	}
+}
+
+func TestOnStart(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		var (
+			rooted bool
+			reqs   []*request.Request
+		)
+		sp := newTestSpider(nil)
+		sp.RuleTree.Root = func(*Context) { rooted = true }
+		sp.Sitemap = &Sitemap{Urls: []string{"http://example.com/sitemap.xml"}}
+		sp.OnStart = func(ctx *Context) error {
+			if fail {
+				return errors.New("login failed")
+			}
+			return nil
+		}
+		sp.CatchRequests(func(req *request.Request) { reqs = append(reqs, req) })
+		sp.Start()
+
+		// OnStart返回错误时Root与Sitemap均不执行
+		if rooted == fail || (len(reqs) == 0) != fail {
+			t.Errorf("fail = %v: rooted = %v, %d requests", fail, rooted, len(reqs))
+		}
+	}
+}
+
+func TestOnFinish(t *testing.T) {
+	var got *SpiderStat
+	sp := newTestSpider(map[string]*Rule{"item": {}})
+	sp.reqMatrix = &scheduler.Matrix{}
+	sp.OnFinish = func(self *Spider, stat SpiderStat) { got = &stat }
+	start := GetContext(sp, nil)
+	sp.onStart(start)
+	PutContext(start)
+
+	req := &request.Request{Url: "http://example.com/", Rule: "item"}
+	ctx := GetContext(sp, req)
+	ctx.Output(map[string]interface{}{"title": "a"})
+	PutContext(ctx)
+	sp.RequestSucceeded(req)
+	sp.RequestFailed(req, errors.New("timeout"))
+	sp.Defer()
+
+	if got == nil {
+		t.Fatal("OnFinish not called")
+	}
+	if got.Success != 1 || got.Failure != 1 || got.Items != 1 || got.Rules["item"] != 1 || got.Time <= 0 {
+		t.Errorf("got %+v", *got)
+	}
+}
+
+func TestOnErrorPanic(t *testing.T) {
+	var calls int
+	sp := newTestSpider(nil)
+	sp.OnError = func(self *Spider, req *request.Request, err error) {
+		calls++
+		panic("hook")
+	}
+	// OnError中的panic不影响调用方
+	sp.RequestFailed(&request.Request{Url: "http://example.com/"}, errors.New("timeout"))
+	if calls != 1 || sp.Stat().Failure != 1 {
+		t.Errorf("calls = %d, stat = %+v", calls, sp.Stat())
+	}
+}
+
+func TestJsHooks(t *testing.T) {
+	m := &SpiderModle{
+		Name:     "js_hooks",
+		OnStart:  `ctx.GetKeyin() != "skip"`,
+		OnItem:   `item.drop ? false : (item.rule = rule, item)`,
+		OnFinish: `self.SetKeyin("items=" + stat.Items)`,
+		OnError:  `self.SetKeyin(req.GetUrl() + " " + err)`,
+	}
+	sp, err := m.Spider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.status = status.RUN
+	sp.RuleTree.Trunk["item"] = &Rule{}
+
+	sp.SetKeyin("skip")
+	if err := sp.OnStart(GetContext(sp, nil)); err == nil {
+		t.Error("OnStart returning false should be an error")
+	}
+	sp.SetKeyin("")
+	if err := sp.OnStart(GetContext(sp, nil)); err != nil {
+		t.Error(err)
+	}
+
+	ctx := GetContext(sp, &request.Request{Url: "http://example.com/", Rule: "item"})
+	ctx.Output(map[string]interface{}{"title": "a"})
+	ctx.Output(map[string]interface{}{"title": "b", "drop": true})
+	items := ctx.PullItems()
+	PutContext(ctx)
+	if len(items) != 1 || items[0]["Data"].(map[string]interface{})["rule"] != "item" {
+		t.Errorf("got %v", items)
+	}
+
+	sp.OnFinish(sp, sp.Stat())
+	if sp.GetKeyin() != "items=1" {
+		t.Errorf("OnFinish: keyin = %q", sp.GetKeyin())
+	}
+	sp.RequestFailed(&request.Request{Url: "http://example.com/a"}, errors.New("timeout"))
+	if sp.GetKeyin() != "http://example.com/a timeout" {
+		t.Errorf("OnError: keyin = %q", sp.GetKeyin())
+	}
+}
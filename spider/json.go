@@ -0,0 +1,102 @@
+package spider
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	"go-spider/logs"
+	"go-spider/spider/jsonpath"
+)
+
+// JSONP回调包裹，如 callback({...}); 或 /**/ jQuery123({...})
+var jsonpRegexp = regexp.MustCompile(`^\s*(?:/\*.*?\*/\s*)?[\w$.\[\]]+\s*\(([\s\S]*)\)\s*;?\s*$`)
+
+// GetJSON 将正文解析为JSON并缓存，自动去除BOM与JSONP回调；数字解析为json.Number以保留精度，解析失败返回nil
+func (self *Context) GetJSON() interface{} {
+	if !self.jsonParsed {
+		self.jsonParsed = true
+		if self.text == nil {
+			self.initText()
+		}
+		b := bytes.TrimPrefix(bytes.TrimSpace(self.text), []byte("\xEF\xBB\xBF"))
+		if len(b) > 0 && b[0] != '{' && b[0] != '[' {
+			if m := jsonpRegexp.FindSubmatch(b); m != nil {
+				b = m[1]
+			}
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&self.jsonData); err != nil {
+			logs.Log.Error(" *     JSON [%v]: %v\n", self.GetUrl(), err)
+			self.jsonData = nil
+		}
+	}
+	return self.jsonData
+}
+
+// JSONAll 返回JSONPath的全部匹配值
+func (self *Context) JSONAll(path string) []interface{} {
+	values, err := jsonpath.Query(self.GetJSON(), path)
+	if err != nil {
+		logs.Log.Error(" *     JSONPath [%v]: %v\n", path, err)
+	}
+	return values
+}
+
+// JSON 返回JSONPath的第一个匹配值，无匹配时返回nil
+func (self *Context) JSON(path string) interface{} {
+	values := self.JSONAll(path)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// JSONString 返回第一个匹配值的字符串形式，对象与数组返回其JSON文本，无匹配或null时返回空
+func (self *Context) JSONString(path string) string {
+	return jsonString(self.JSON(path))
+}
+
+// JSONStrings 返回全部匹配值的字符串形式
+func (self *Context) JSONStrings(path string) []string {
+	values := self.JSONAll(path)
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = jsonString(v)
+	}
+	return strs
+}
+
+// JSONNumber 返回第一个匹配值的数值，字符串形式的数字同样可用，否则返回0
+func (self *Context) JSONNumber(path string) float64 {
+	switch v := self.JSON(path).(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,59 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetJSON(t *testing.T) {
+	cases := map[string]string{
+		"plain":   `{"id": 12345678901234567890, "name": "a"}`,
+		"bom":     "\xEF\xBB\xBF" + `{"id": 12345678901234567890, "name": "a"}`,
+		"jsonp":   `callback({"id": 12345678901234567890, "name": "a"});`,
+		"comment": "/**/ jQuery1_2.cb (\n{\"id\": 12345678901234567890, \"name\": \"a\"}\n)",
+	}
+	for name, body := range cases {
+		ctx := newTestContext(nil, "http://example.com/api", "application/json", body)
+		if got := ctx.JSONString("$.id"); got != "12345678901234567890" {
+			t.Errorf("%s: id = %q", name, got)
+		}
+		if got := ctx.JSONString("name"); got != "a" {
+			t.Errorf("%s: name = %q", name, got)
+		}
+		PutContext(ctx)
+	}
+
+	ctx := newTestContext(nil, "http://example.com/api", "application/json", `callback(`)
+	defer PutContext(ctx)
+	if ctx.GetJSON() != nil || ctx.JSON("$.id") != nil {
+		t.Error("invalid JSON should give nil")
+	}
+}
+
+func TestGetJSONCache(t *testing.T) {
+	ctx := newTestContext(nil, "http://example.com/api", "application/json", `{"list": [{"n": 1}, {"n": "2"}, {"n": true}]}`)
+	defer PutContext(ctx)
+
+	data := ctx.GetJSON().(map[string]interface{})
+	data["cached"] = "yes"
+	if got := ctx.JSONString("$.cached"); got != "yes" {
+		t.Error("GetJSON should parse the body once")
+	}
+	if got := ctx.JSONStrings("$.list[*].n"); !reflect.DeepEqual(got, []string{"1", "2", "true"}) {
+		t.Errorf("JSONStrings = %q", got)
+	}
+	if got := ctx.JSONNumber("$.list[1].n"); got != 2 {
+		t.Errorf("JSONNumber = %v", got)
+	}
+	if got := ctx.JSONString("$.list[0]"); got != `{"n":1}` {
+		t.Errorf("object = %q", got)
+	}
+
+	ctx.ResetText(`{"list": []}`)
+	if got := ctx.JSONString("$.cached"); got != "" {
+		t.Errorf("ResetText kept the old JSON: %q", got)
+	}
+	if got := ctx.JSONAll("$.list[*]"); len(got) != 0 {
+		t.Errorf("after ResetText = %v", got)
+	}
+}
@@ -0,0 +1,319 @@
+// Package jsonpath 对encoding/json解码得到的数据执行JSONPath查询。
+//
+// 支持的语法：$ 根节点，.key 与 ['key'] 子节点，.* 与 [*] 全部子节点，..key 递归查找，
+// [n] 下标（负数从末尾计），[a,b] 并集，[start:end] 切片。
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Path 编译后的JSONPath
+	Path struct {
+		expr  string
+		steps []step
+	}
+	step struct {
+		recursive bool
+		wildcard  bool
+		keys      []string
+		indexes   []int
+		slice     *[2]*int
+	}
+)
+
+var cache = struct {
+	m map[string]*Path
+	sync.RWMutex
+}{m: map[string]*Path{}}
+
+// Compile 编译JSONPath，相同表达式只编译一次
+func Compile(expr string) (*Path, error) {
+	cache.RLock()
+	p, ok := cache.m[expr]
+	cache.RUnlock()
+	if ok {
+		return p, nil
+	}
+	p, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	cache.Lock()
+	cache.m[expr] = p
+	cache.Unlock()
+	return p, nil
+}
+
+// Query 编译并执行JSONPath
+func Query(data interface{}, expr string) ([]interface{}, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Get(data), nil
+}
+
+func (self *Path) String() string {
+	return self.expr
+}
+
+// Get 返回全部匹配的值，按文档顺序排列（对象的键按字母序）
+func (self *Path) Get(data interface{}) []interface{} {
+	cur := []interface{}{data}
+	for _, s := range self.steps {
+		var next []interface{}
+		for _, v := range cur {
+			if s.recursive {
+				walk(v, func(v interface{}) {
+					next = s.apply(v, next)
+				})
+			} else {
+				next = s.apply(v, next)
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+func (s step) apply(v interface{}, out []interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			for _, k := range sortedKeys(v) {
+				out = append(out, v[k])
+			}
+		}
+		for _, k := range s.keys {
+			if e, ok := v[k]; ok {
+				out = append(out, e)
+			}
+		}
+	case []interface{}:
+		n := len(v)
+		if s.wildcard {
+			out = append(out, v...)
+		}
+		for _, i := range s.indexes {
+			if i < 0 {
+				i += n
+			}
+			if i >= 0 && i < n {
+				out = append(out, v[i])
+			}
+		}
+		if s.slice != nil {
+			start, end := 0, n
+			if s.slice[0] != nil {
+				start = clamp(*s.slice[0], n)
+			}
+			if s.slice[1] != nil {
+				end = clamp(*s.slice[1], n)
+			}
+			for i := start; i < end; i++ {
+				out = append(out, v[i])
+			}
+		}
+	}
+	return out
+}
+
+// walk 先序遍历v及其全部后代
+func walk(v interface{}, f func(interface{})) {
+	f(v)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			walk(v[k], f)
+		}
+	case []interface{}:
+		for _, e := range v {
+			walk(e, f)
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func clamp(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+func parse(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		// 允许省略开头的 $.
+		s = "." + s
+	}
+	for len(s) > 0 {
+		var st step
+		if strings.HasPrefix(s, "..") {
+			st.recursive = true
+			s = s[1:]
+			if len(s) > 1 && s[1] == '[' {
+				s = s[1:]
+			}
+		}
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			n := strings.IndexAny(s, ".[")
+			if n < 0 {
+				n = len(s)
+			}
+			name := s[:n]
+			s = s[n:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("jsonpath %q: empty name", expr)
+			case "*":
+				st.wildcard = true
+			default:
+				st.keys = []string{name}
+			}
+			p.steps = append(p.steps, st)
+			continue
+		case '[':
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, s)
+		}
+		end := closingBracket(s)
+		if end < 0 {
+			return nil, fmt.Errorf("jsonpath %q: unterminated [", expr)
+		}
+		if err := parseBracket(s[1:end], &st); err != nil {
+			return nil, fmt.Errorf("jsonpath %q: %v", expr, err)
+		}
+		s = s[end+1:]
+		p.steps = append(p.steps, st)
+	}
+	return p, nil
+}
+
+// closingBracket 返回与s[0]的[配对的]位置，忽略引号内的字符
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(in string, st *step) error {
+	in = strings.TrimSpace(in)
+	switch {
+	case in == "*":
+		st.wildcard = true
+		return nil
+	case strings.HasPrefix(in, "?"):
+		return fmt.Errorf("filter expressions are not supported")
+	}
+	for _, part := range splitUnion(in) {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			return fmt.Errorf("empty selector")
+		case part[0] == '\'' || part[0] == '"':
+			key, err := unquote(part)
+			if err != nil {
+				return err
+			}
+			st.keys = append(st.keys, key)
+		case strings.Contains(part, ":"):
+			bounds := strings.SplitN(part, ":", 3)
+			var slice [2]*int
+			for i := 0; i < 2; i++ {
+				if b := strings.TrimSpace(bounds[i]); b != "" {
+					n, err := strconv.Atoi(b)
+					if err != nil {
+						return fmt.Errorf("bad slice %q", part)
+					}
+					slice[i] = &n
+				}
+			}
+			st.slice = &slice
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return fmt.Errorf("bad index %q", part)
+			}
+			st.indexes = append(st.indexes, n)
+		}
+	}
+	return nil
+}
+
+func splitUnion(s string) []string {
+	var (
+		parts []string
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("bad quoted key %s", s)
+	}
+	if s[0] == '\'' {
+		s = `"` + strings.Replace(strings.Replace(s[1:len(s)-1], `\'`, `'`, -1), `"`, `\"`, -1) + `"`
+	}
+	var key string
+	if err := json.Unmarshal([]byte(s), &key); err != nil {
+		return "", fmt.Errorf("bad quoted key %s", s)
+	}
+	return key, nil
+}
@@ -0,0 +1,65 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const doc = `{
+	"store": {
+		"book": [
+			{"title": "A", "price": 8.95, "tags": ["x"]},
+			{"title": "B", "price": 12.99},
+			{"title": "C", "price": 22.99, "isbn": "0-553"}
+		],
+		"bicycle": {"price": 19.95},
+		"odd key": 1
+	}
+}`
+
+func TestQuery(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(doc), &data); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]interface{}{
+		"$.store.book[0].title":      {"A"},
+		"store.book[-1].title":       {"C"},
+		"$.store.book[*].title":      {"A", "B", "C"},
+		"$.store.book[0,2].title":    {"A", "C"},
+		"$.store.book[1:].title":     {"B", "C"},
+		"$.store.book[:-2].title":    {"A"},
+		"$['store']['odd key']":      {1.0},
+		"$..isbn":                    {"0-553"},
+		"$.store.bicycle.*":          {19.95},
+		"$.store.book[?(@.price)]":   nil,
+		"$.store.missing":            {},
+		"$..book[2].title":           {"C"},
+		`$.store["book"][0].tags[0]`: {"x"},
+	}
+	for expr, want := range cases {
+		got, err := Query(data, expr)
+		if want == nil {
+			if err == nil {
+				t.Errorf("%s: expected error", expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+
+	prices, _ := Query(data, "$..price")
+	if len(prices) != 4 {
+		t.Errorf("$..price: got %d values, want 4", len(prices))
+	}
+}
@@ -0,0 +1,143 @@
+package spider
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+// JsTimeout 动态规则单次脚本执行的默认超时
+var JsTimeout = 30 * time.Second
+
+type (
+	// jsRuntime 同一动态蜘蛛的脚本共用的虚拟机池
+	jsRuntime struct {
+		spider  string
+		timeout time.Duration
+		pool    sync.Pool
+	}
+	jsScript struct {
+		name   string
+		script *otto.Script
+	}
+	// JsTimeoutError 脚本执行超时
+	JsTimeoutError struct {
+		Spider  string
+		Script  string
+		Timeout time.Duration
+	}
+)
+
+func (self *JsTimeoutError) Error() string {
+	return fmt.Sprintf("动态规则 [%s][%s] 执行超过 %v，已中断", self.Spider, self.Script, self.Timeout)
+}
+
+func newJsRuntime(spider string, timeout time.Duration) *jsRuntime {
+	if timeout <= 0 {
+		timeout = JsTimeout
+	}
+	return &jsRuntime{
+		spider:  spider,
+		timeout: timeout,
+		pool: sync.Pool{
+			New: func() interface{} { return otto.New() },
+		},
+	}
+}
+
+// compile 预编译脚本，src为空时返回nil
+func (self *jsRuntime) compile(name, src string) (*jsScript, error) {
+	if src == "" {
+		return nil, nil
+	}
+	script, err := otto.New().Compile(name, src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &jsScript{name: name, script: script}, nil
+}
+
+// run 从池中取出虚拟机执行脚本，超时则中断并返回*JsTimeoutError，中断过的虚拟机不再复用；
+// 虚拟机归还前会清空脚本新建的全局变量，脚本间不能借全局变量传递状态
+func (self *jsRuntime) run(js *jsScript, vars map[string]interface{}) (val interface{}, err error) {
+	vm := self.pool.Get().(*otto.Otto)
+	for k, v := range vars {
+		vm.Set(k, v)
+	}
+	timeoutErr := &JsTimeoutError{Spider: self.spider, Script: js.name, Timeout: self.timeout}
+	ch := make(chan func(), 1)
+	fired := make(chan struct{})
+	vm.Interrupt = ch
+	timer := time.AfterFunc(self.timeout, func() {
+		ch <- func() {
+			panic(timeoutErr)
+		}
+		close(fired)
+	})
+	defer func() {
+		if !timer.Stop() {
+			// 脚本恰在超时时结束，丢弃未被处理的中断
+			<-fired
+			select {
+			case <-ch:
+			default:
+			}
+		}
+		vm.Interrupt = nil
+		if p := recover(); p != nil {
+			if p != timeoutErr {
+				panic(p)
+			}
+			err = timeoutErr
+			return
+		}
+		resetGlobals(vm)
+		self.pool.Put(vm)
+	}()
+	v, err := vm.Run(js.script)
+	if err != nil {
+		return nil, err
+	}
+	val, _ = v.Export()
+	return val, nil
+}
+
+const jsGlobalNames = `Object.getOwnPropertyNames(this).join("\n")`
+
+// jsBuiltins 新建虚拟机自带的全局属性
+var jsBuiltins = func() map[string]bool {
+	builtins := make(map[string]bool)
+	for _, k := range globalNames(otto.New()) {
+		builtins[k] = true
+	}
+	return builtins
+}()
+
+func globalNames(vm *otto.Otto) []string {
+	v, err := vm.Run(jsGlobalNames)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(v.String(), "\n")
+}
+
+// resetGlobals 将内置以外的全局变量置为undefined
+func resetGlobals(vm *otto.Otto) {
+	for _, k := range globalNames(vm) {
+		if !jsBuiltins[k] {
+			vm.Set(k, otto.UndefinedValue())
+		}
+	}
+}
+
+// runString 执行脚本并将结果转为字符串
+func (self *jsRuntime) runString(js *jsScript, vars map[string]interface{}) (string, error) {
+	val, err := self.run(js, vars)
+	if err != nil || val == nil {
+		return "", err
+	}
+	return fmt.Sprint(val), nil
+}
@@ -0,0 +1,39 @@
+package spider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJsRuntimeTimeoutReuse(t *testing.T) {
+	js := newJsRuntime("test", 50*time.Millisecond)
+	loop, _ := js.compile("loop", "for (;;) {}")
+	set, _ := js.compile("set", "leak = n; n * 2")
+	get, _ := js.compile("get", "typeof leak")
+
+	if _, err := js.run(loop, nil); err == nil {
+		t.Fatal("want timeout")
+	} else if _, ok := err.(*JsTimeoutError); !ok {
+		t.Fatalf("got %v, want *JsTimeoutError", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := js.runString(set, map[string]interface{}{"n": i + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"2", "4", "6"}[i]; got != want {
+			t.Errorf("run %d: got %q, want %q", i, got, want)
+		}
+	}
+	// 归还的虚拟机不保留上次执行的全局变量
+	if got, err := js.runString(get, nil); err != nil || got != "undefined" {
+		t.Errorf("leaked global: %q, %v", got, err)
+	}
+
+	// 超时时间过后复用的虚拟机不应收到过期的中断
+	time.Sleep(100 * time.Millisecond)
+	if _, err := js.run(set, map[string]interface{}{"n": 1}); err != nil {
+		t.Errorf("reused vm: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package spider
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go-spider/aid/domain"
+	"go-spider/common/goquery"
+	"go-spider/downloader/request"
+	"go-spider/logs"
+)
+
+// LinkOptions FollowLinks的可选项
+type LinkOptions struct {
+	Attr       string       // 链接所在的属性，默认为href
+	Include    []string     // 正则，非空时链接须匹配其一
+	Exclude    []string     // 正则，链接匹配其一时跳过
+	SameDomain bool         // 仅跟随与当前页面属于同一可注册域名的链接
+	Priority   int          // 请求优先级
+	Temp       request.Temp // 复制到每个请求
+	Limit      int          // 本次最多跟随的链接数，0为不限
+}
+
+// FollowLinks 将selector（CSS，为空时为a[href]）匹配元素中的链接以ruleName规则加入队列；
+// 相对链接按<base href>或跳转后的最终页面补全，去除#片段，仅跟随http(s)链接，同一页面内相同链接对同一规则只加入一次；
+// 返回本次加入队列的链接
+func (self *Context) FollowLinks(selector, ruleName string, opts ...*LinkOptions) []string {
+	opt := &LinkOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	attr := opt.Attr
+	if attr == "" {
+		attr = "href"
+	}
+	if selector == "" {
+		selector = "a[" + attr + "]"
+	}
+	include, ok := compileLinkPatterns(opt.Include)
+	if !ok {
+		return nil
+	}
+	exclude, ok := compileLinkPatterns(opt.Exclude)
+	if !ok {
+		return nil
+	}
+	if self.followed == nil {
+		self.followed = make(map[string]bool)
+	}
+
+	dom := self.GetDom()
+	page := self.finalURL()
+	base := baseURL(dom, page)
+	var links []string
+	dom.Find(selector).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, ok := s.Attr(attr)
+		if !ok {
+			return true
+		}
+		link := resolveLink(base, href)
+		key := ruleName + "\x00" + link
+		switch {
+		case link == "", self.followed[key]:
+			return true
+		case len(include) > 0 && !matchAny(include, link):
+			return true
+		case matchAny(exclude, link):
+			return true
+		case opt.SameDomain && !domain.SameSite(link, page.String()):
+			return true
+		}
+		self.followed[key] = true
+		req := &request.Request{
+			Url:      link,
+			Rule:     ruleName,
+			Priority: opt.Priority,
+		}
+		if len(opt.Temp) > 0 {
+			req.Temp = make(request.Temp, len(opt.Temp))
+			for k, v := range opt.Temp {
+				req.Temp[k] = v
+			}
+		}
+		self.AddQueue(req)
+		links = append(links, link)
+		return opt.Limit <= 0 || len(links) < opt.Limit
+	})
+	return links
+}
+
+// JsFollowLinks 供动态规则调用，opts的键与LinkOptions的字段同名，Include与Exclude可为字符串或数组
+func (self *Context) JsFollowLinks(selector, ruleName string, opts map[string]interface{}) []string {
+	opt := &LinkOptions{}
+	opt.Attr, _ = opts["Attr"].(string)
+	opt.Include = jsStrings(opts["Include"])
+	opt.Exclude = jsStrings(opts["Exclude"])
+	opt.SameDomain, _ = opts["SameDomain"].(bool)
+	if t, ok := opts["Priority"].(int64); ok {
+		opt.Priority = int(t)
+	}
+	if t, ok := opts["Limit"].(int64); ok {
+		opt.Limit = int(t)
+	}
+	if t, ok := opts["Temp"].(map[string]interface{}); ok {
+		opt.Temp = t
+	}
+	return self.FollowLinks(selector, ruleName, opt)
+}
+
+// finalURL 返回跳转后的最终链接，无响应时为请求链接
+func (self *Context) finalURL() *url.URL {
+	if self.Response != nil && self.Response.Request != nil && self.Response.Request.URL != nil {
+		return self.Response.Request.URL
+	}
+	u, err := url.Parse(self.GetUrl())
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// baseURL 返回补全相对链接的基准，有<base href>时以其为准
+func baseURL(dom *goquery.Document, base *url.URL) *url.URL {
+	if base == nil {
+		return nil
+	}
+	if href, ok := dom.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			return u
+		}
+	}
+	return base
+}
+
+// resolveLink 补全链接并去除片段，非http(s)链接返回空
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if base == nil || href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+func compileLinkPatterns(patterns []string) ([]*regexp.Regexp, bool) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			logs.Log.Error(" *     FollowLinks 正则 [%v]: %v\n", p, err)
+			return nil, false
+		}
+		res = append(res, re)
+	}
+	return res, true
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return strs
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package spider
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"go-spider/downloader/request"
+)
+
+func TestResolveLink(t *testing.T) {
+	base, _ := url.Parse("http://example.com/a/b.html")
+	for href, want := range map[string]string{
+		"c.html":               "http://example.com/a/c.html",
+		"/d#top":               "http://example.com/d",
+		"//cdn.example.com/x":  "http://cdn.example.com/x",
+		"#top":                 "",
+		"javascript:void(0)":   "",
+		"mailto:a@example.com": "",
+	} {
+		if got := resolveLink(base, href); got != want {
+			t.Errorf("resolveLink(%q) = %q, want %q", href, got, want)
+		}
+	}
+}
+
+const linksFixture = `<html><head><base href="http://cdn.example.com/base/"></head><body>
+<a href="a.html">a</a>
+<a href="a.html#x">a again</a>
+<a href="/b.html">b</a>
+<a href="http://other.com/c.html">c</a>
+<a href="skip.html">skip</a>
+<a href="javascript:;">js</a>
+</body></html>`
+
+func followTest(t *testing.T, body string) (*Context, *[]*request.Request) {
+	reqs := new([]*request.Request)
+	sp := newTestSpider(nil)
+	sp.CatchRequests(func(req *request.Request) { *reqs = append(*reqs, req) })
+	return newTestContext(sp, "http://example.com/list/index.html", "text/html; charset=utf-8", body), reqs
+}
+
+func TestFollowLinks(t *testing.T) {
+	ctx, reqs := followTest(t, linksFixture)
+	defer PutContext(ctx)
+
+	got := ctx.FollowLinks("", "detail", &LinkOptions{Exclude: []string{`skip`}})
+	want := []string{"http://cdn.example.com/base/a.html", "http://cdn.example.com/b.html", "http://other.com/c.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(*reqs) != 3 || (*reqs)[0].GetRuleName() != "detail" || (*reqs)[0].GetReferer() != "http://example.com/list/index.html" {
+		t.Errorf("queued %v", *reqs)
+	}
+
+	// 同一规则不重复加入，其他规则不受影响
+	if got := ctx.FollowLinks("", "detail"); len(got) != 0 {
+		t.Errorf("followed again for the same rule: %q", got)
+	}
+	if got := ctx.FollowLinks("", "other", &LinkOptions{Include: []string{`\.html$`}, Limit: 2}); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("other rule: got %q", got)
+	}
+	if got := ctx.FollowLinks("", "same", &LinkOptions{SameDomain: true}); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("SameDomain: got %q", got)
+	}
+}
+
+func TestFollowLinksRedirect(t *testing.T) {
+	ctx, _ := followTest(t, `<a href="next.html">next</a><a href="http://www.example.com/x">x</a>`)
+	defer PutContext(ctx)
+	// 跳转后以最终链接补全
+	final, _ := url.Parse("http://other.com/moved/page.html")
+	ctx.Response.Request.URL = final
+
+	got := ctx.FollowLinks("a", "detail", &LinkOptions{SameDomain: true})
+	if want := []string{"http://other.com/moved/next.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package spider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Param 蜘蛛的类型化参数声明，类型、默认值与校验规则同SchemaField，取代在Keyin中自行编码多个参数
+type Param struct {
+	SchemaField
+	Description string
+}
+
+// prepare 校验类型并编译Pattern，可重复调用
+func (self *SchemaField) prepare() error {
+	switch self.Type {
+	case "", FIELD_STRING, FIELD_INT, FIELD_FLOAT, FIELD_TIME, FIELD_BOOL, FIELD_LIST:
+	default:
+		return fmt.Errorf("字段 %s: 未知的类型 %q", self.Name, self.Type)
+	}
+	if self.Pattern != "" && self.pattern == nil {
+		pattern, err := regexp.Compile(self.Pattern)
+		if err != nil {
+			return fmt.Errorf("字段 %s: %v", self.Name, err)
+		}
+		self.pattern = pattern
+	}
+	return nil
+}
+
+// SetParams 按声明转换并校验一组参数值，缺失的取默认值；存在未声明的参数或校验失败时返回错误且不修改当前参数
+func (self *Spider) SetParams(values map[string]interface{}) error {
+	params := make(map[string]interface{}, len(self.Params))
+	for name := range values {
+		if self.Param(name) == nil {
+			return fmt.Errorf("蜘蛛 %s 未声明参数 %s", self.GetName(), name)
+		}
+	}
+	for _, p := range self.Params {
+		if err := p.prepare(); err != nil {
+			return fmt.Errorf("蜘蛛 %s 参数 %v", self.GetName(), err)
+		}
+		v, err := p.coerce(values[p.Name])
+		if err != nil {
+			return fmt.Errorf("蜘蛛 %s 参数 %s: %v", self.GetName(), p.Name, err)
+		}
+		params[p.Name] = v
+	}
+	self.params = params
+	return nil
+}
+
+// Param 返回指定名称的参数声明
+func (self *Spider) Param(name string) *Param {
+	for _, p := range self.Params {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// GetParam 返回参数值，未调用SetParams时返回默认值，未声明时返回nil
+func (self *Spider) GetParam(name string) interface{} {
+	if v, ok := self.params[name]; ok {
+		return v
+	}
+	p := self.Param(name)
+	if p == nil {
+		return nil
+	}
+	if p.Default != nil {
+		if v, err := p.coerce(p.Default); err == nil {
+			return v
+		}
+	}
+	return p.zero()
+}
+
+// GetParams 返回全部参数值
+func (self *Spider) GetParams() map[string]interface{} {
+	params := make(map[string]interface{}, len(self.Params))
+	for _, p := range self.Params {
+		params[p.Name] = self.GetParam(p.Name)
+	}
+	return params
+}
+
+// ParamsString 参数的可读形式，用于日志与报告
+func (self *Spider) ParamsString() string {
+	if len(self.Params) == 0 {
+		return ""
+	}
+	params := self.GetParams()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var s string
+	for i, name := range names {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%s=%v", name, params[name])
+	}
+	return s
+}
+
+// GetParam 返回蜘蛛的参数值
+func (self *Context) GetParam(name string) interface{} {
+	return self.spider.GetParam(name)
+}
@@ -0,0 +1,38 @@
+package spider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpiderParams(t *testing.T) {
+	sp := &Spider{Name: "shop", RuleTree: &RuleTree{Trunk: map[string]*Rule{}}, Params: []*Param{
+		{SchemaField: SchemaField{Name: "city", Required: true, Enum: []string{"beijing", "shanghai"}}},
+		{SchemaField: SchemaField{Name: "pages", Type: FIELD_INT, Default: 5, Min: Limit(1)}},
+		{SchemaField: SchemaField{Name: "since", Type: FIELD_TIME}},
+	}}
+	if got := sp.GetParam("pages"); got != int64(5) {
+		t.Errorf("default pages = %#v", got)
+	}
+	if err := sp.SetParams(map[string]interface{}{"pages": "3"}); err == nil || !strings.Contains(err.Error(), "city") {
+		t.Errorf("missing required param: %v", err)
+	}
+	if err := sp.SetParams(map[string]interface{}{"city": "beijing", "color": "red"}); err == nil {
+		t.Error("expected an error for an undeclared param")
+	}
+	if err := sp.SetParams(map[string]interface{}{"city": "beijing", "pages": "3", "since": "2020-01-02"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sp.GetParam("pages"); got != int64(3) {
+		t.Errorf("pages = %#v", got)
+	}
+	if got := sp.GetParam("since"); got != "2020-01-02 00:00:00" {
+		t.Errorf("since = %#v", got)
+	}
+	if got, want := sp.ParamsString(), "city=beijing pages=3 since=2020-01-02 00:00:00"; got != want {
+		t.Errorf("ParamsString() = %q, want %q", got, want)
+	}
+	if cp := sp.Copy(); cp.GetParam("city") != "beijing" {
+		t.Error("Copy should keep param values")
+	}
+}
@@ -0,0 +1,201 @@
+package spider
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"go-spider/config"
+)
+
+// SpiderFileExts 动态规则文件的扩展名，按扩展名选择解析格式
+var SpiderFileExts = []string{config.SPIDER_EXT, ".json", ".yaml", ".yml"}
+
+// SpiderFileError 动态规则文件的解析错误，Line为0表示无法定位到行
+type SpiderFileError struct {
+	File  string
+	Line  int
+	Field string
+	Err   error
+}
+
+func (self *SpiderFileError) Error() string {
+	var s = self.File
+	if self.Line > 0 {
+		s += fmt.Sprintf(":%d", self.Line)
+	}
+	if self.Field != "" {
+		s += ": field " + self.Field
+	}
+	return s + ": " + self.Err.Error()
+}
+
+func spiderFiles() []string {
+	var files []string
+	for _, ext := range SpiderFileExts {
+		matches, _ := filepath.Glob(path.Join(config.SPIDER_DIR, "*"+ext))
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// ParseSpiderFile 读取并校验单个动态规则文件
+func ParseSpiderFile(filename string) (*SpiderModle, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpiderModle(filename, b)
+}
+
+// ParseSpiderModle 按filename的扩展名解析动态规则
+func ParseSpiderModle(filename string, b []byte) (*SpiderModle, error) {
+	var (
+		m   = &SpiderModle{file: filename}
+		err error
+	)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = parseJSONModle(b, m)
+	case ".yaml", ".yml":
+		err = parseYAMLModle(b, m)
+	default:
+		err = parseXMLModle(b, m)
+	}
+	if err == nil {
+		err = m.validate()
+	}
+	if err != nil {
+		if e, ok := err.(*SpiderFileError); ok {
+			e.File = filename
+			return nil, e
+		}
+		return nil, &SpiderFileError{File: filename, Err: err}
+	}
+	return m, nil
+}
+
+func parseJSONModle(b []byte, m *SpiderModle) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(m)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		return &SpiderFileError{Line: lineOf(b, e.Offset), Err: err}
+	case *json.UnmarshalTypeError:
+		return &SpiderFileError{
+			Line:  lineOf(b, e.Offset),
+			Field: e.Field,
+			Err:   fmt.Errorf("cannot use %s as %v", e.Value, e.Type),
+		}
+	}
+	// 未知字段的错误不带位置，按字段名回查
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		name := strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+		e := &SpiderFileError{Field: name, Err: fmt.Errorf("unknown field")}
+		if i := bytes.Index(b, []byte(`"`+name+`"`)); i >= 0 {
+			e.Line = lineOf(b, int64(i)+1)
+		}
+		return e
+	}
+	return err
+}
+
+var (
+	yamlLineRegexp  = regexp.MustCompile(`line (\d+): (.*)`)
+	yamlFieldRegexp = regexp.MustCompile(`field (\S+) not found`)
+)
+
+func parseYAMLModle(b []byte, m *SpiderModle) error {
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	err := dec.Decode(m)
+	if err == nil {
+		return nil
+	}
+	var msgs []string
+	if e, ok := err.(*yaml.TypeError); ok {
+		msgs = e.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	// 只报告第一处错误
+	sm := yamlLineRegexp.FindStringSubmatch(msgs[0])
+	if sm == nil {
+		return fmt.Errorf("%s", msgs[0])
+	}
+	e := &SpiderFileError{Err: fmt.Errorf("%s", sm[2])}
+	fmt.Sscan(sm[1], &e.Line)
+	if fm := yamlFieldRegexp.FindStringSubmatch(sm[2]); fm != nil {
+		e.Field, e.Err = fm[1], fmt.Errorf("unknown field")
+	}
+	return e
+}
+
+func parseXMLModle(b []byte, m *SpiderModle) error {
+	err := xml.Unmarshal(b, m)
+	if e, ok := err.(*xml.SyntaxError); ok {
+		return &SpiderFileError{Line: e.Line, Err: fmt.Errorf("%s", e.Msg)}
+	}
+	return err
+}
+
+// validate 检查解析后的必填项，定位到字段
+func (m *SpiderModle) validate() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return &SpiderFileError{Field: "Name", Err: fmt.Errorf("required")}
+	}
+	for i, p := range m.Params {
+		if p.Name == "" {
+			return &SpiderFileError{Field: fmt.Sprintf("Param[%d].name", i), Err: fmt.Errorf("required")}
+		}
+	}
+	seen := make(map[string]bool, len(m.Trunk))
+	for i, rule := range m.Trunk {
+		if rule.Name == "" {
+			return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].name", i), Err: fmt.Errorf("required")}
+		}
+		if seen[rule.Name] {
+			return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].name", i), Err: fmt.Errorf("duplicate rule %q", rule.Name)}
+		}
+		seen[rule.Name] = true
+		for j, f := range rule.Fields {
+			if f.Css != "" && f.Xpath != "" {
+				return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].Field[%d]", i, j), Err: fmt.Errorf("css and xpath are mutually exclusive")}
+			}
+			if f.Name == "" && f.Follow == "" {
+				return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].Field[%d]", i, j), Err: fmt.Errorf("needs a name or a follow rule")}
+			}
+			if _, err := ParseProcessors(f.Process); err != nil {
+				return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].Field[%d].process", i, j), Err: err}
+			}
+		}
+		for j, p := range rule.Processes {
+			if _, err := ParseProcessors(p.Chain); err != nil {
+				return &SpiderFileError{Field: fmt.Sprintf("Rule[%d].Process[%d]", i, j), Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// lineOf 将字节偏移转换为行号（从1开始）
+func lineOf(b []byte, offset int64) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,34 @@
+package spider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpiderModle(t *testing.T) {
+	cases := []struct {
+		file, src, want string
+	}{
+		{"a.json", "{\n\"Name\": \"a\",\n\"Pausetime\": \"x\"\n}", "a.json:3: field Pausetime:"},
+		{"a.json", "{\n\"Name\": \"a\",\n\"Bogus\": 1\n}", "a.json:3: field Bogus: unknown field"},
+		{"a.json", "{\n\"Name\": \"a\",,\n}", "a.json:2:"},
+		{"a.yaml", "Name: a\nRule:\n  - name: r\n    folow: x\n", "a.yaml:4: field folow: unknown field"},
+		{"a.yml", "Name: a\nPausetime: [1]\n", "a.yml:2:"},
+		{"a.xml", "<Spider>\n<Name>a</Name>\n<Rule name=r/>\n</Spider>", "a.xml:3:"},
+		{"a.json", `{"Name": "a", "Rule": [{"name": "r"}, {"name": "r"}]}`, "a.json: field Rule[1].name: duplicate rule"},
+	}
+	for _, c := range cases {
+		_, err := ParseSpiderModle(c.file, []byte(c.src))
+		if err == nil || !strings.HasPrefix(err.Error(), c.want) {
+			t.Errorf("%s %q: got error %v, want prefix %q", c.file, c.src, err, c.want)
+		}
+	}
+
+	m, err := ParseSpiderModle("a.yaml", []byte("Name: a\nRule:\n  - name: list\n    Field:\n      - {name: title, css: h1}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Trunk) != 1 || m.Trunk[0].Fields[0].Css != "h1" {
+		t.Errorf("unexpected modle: %+v", m)
+	}
+}
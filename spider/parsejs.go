@@ -1,114 +1,232 @@
 package spider
 
 import (
-	"encoding/xml"
-	"io/ioutil"
+	"fmt"
 	"log"
-	"path"
-	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 	"go-spider/config"
+	"go-spider/downloader/request"
 	"go-spider/logs"
 )
 
 type (
+	// SpiderModle 动态规则，XML、JSON与YAML格式使用相同的字段名
 	SpiderModle struct {
-		Name            string      `xml:"Name"`
-		Description     string      `xml:"Description"`
-		Pausetime       int64       `xml:"Pausetime"`
-		EnableLimit     bool        `xml:"EnableLimit"`
-		EnableKeyin     bool        `xml:"EnableKeyin"`
-		EnableCookie    bool        `xml:"EnableCookie"`
-		NotDefaultField bool        `xml:"NotDefaultField"`
-		Namespace       string      `xml:"Namespace>Script"`
-		SubNamespace    string      `xml:"SubNamespace>Script"`
-		Root            string      `xml:"Root>Script"`
-		Trunk           []RuleModle `xml:"Rule"`
+		Name            string      `xml:"Name" json:"Name" yaml:"Name"`
+		Description     string      `xml:"Description" json:"Description" yaml:"Description"`
+		Pausetime       int64       `xml:"Pausetime" json:"Pausetime" yaml:"Pausetime"`
+		Timeout         int64       `xml:"Timeout" json:"Timeout" yaml:"Timeout"` // 单次脚本执行超时（毫秒），0为JsTimeout
+		EnableLimit     bool        `xml:"EnableLimit" json:"EnableLimit" yaml:"EnableLimit"`
+		EnableKeyin     bool        `xml:"EnableKeyin" json:"EnableKeyin" yaml:"EnableKeyin"`
+		EnableCookie    bool        `xml:"EnableCookie" json:"EnableCookie" yaml:"EnableCookie"`
+		Profile         string      `xml:"Profile" json:"Profile" yaml:"Profile"`
+		StickyProxy     bool        `xml:"StickyProxy" json:"StickyProxy" yaml:"StickyProxy"`
+		NotDefaultField bool        `xml:"NotDefaultField" json:"NotDefaultField" yaml:"NotDefaultField"`
+		Namespace       string      `xml:"Namespace>Script" json:"Namespace" yaml:"Namespace"`
+		SubNamespace    string      `xml:"SubNamespace>Script" json:"SubNamespace" yaml:"SubNamespace"`
+		Params          []ParamModle `xml:"Param" json:"Param" yaml:"Param"`
+		Root            string      `xml:"Root>Script" json:"Root" yaml:"Root"`
+		OnStart         string      `xml:"OnStart>Script" json:"OnStart" yaml:"OnStart"`    // 返回false时不再执行Root
+		OnFinish        string      `xml:"OnFinish>Script" json:"OnFinish" yaml:"OnFinish"` // 可读取self与stat
+		OnItem          string      `xml:"OnItem>Script" json:"OnItem" yaml:"OnItem"`       // 可读取ctx、rule与item，返回false丢弃，返回对象替换
+		OnError         string      `xml:"OnError>Script" json:"OnError" yaml:"OnError"`    // 可读取self、req与err
+		Trunk           []RuleModle `xml:"Rule" json:"Rule" yaml:"Rule"`
+		file            string
 	}
 	RuleModle struct {
-		Name      string `xml:"name,attr"`
-		ParseFunc string `xml:"ParseFunc>Script"`
-		AidFunc   string `xml:"AidFunc>Script"`
+		Name      string       `xml:"name,attr" json:"name" yaml:"name"`
+		Items     ItemsModle   `xml:"Items" json:"Items" yaml:"Items"`
+		Fields    []FieldModle   `xml:"Field" json:"Field" yaml:"Field"`
+		Processes []ProcessModle `xml:"Process" json:"Process" yaml:"Process"`
+		Feed      *FeedModle     `xml:"Feed" json:"Feed" yaml:"Feed"`
+		ParseFunc string         `xml:"ParseFunc>Script" json:"ParseFunc" yaml:"ParseFunc"`
+		AidFunc   string         `xml:"AidFunc>Script" json:"AidFunc" yaml:"AidFunc"`
+	}
+	// ParamModle 类型化参数，如 <Param name="city" type="string" required="true">城市</Param>，脚本中以ctx.GetParam读取
+	ParamModle struct {
+		Name        string   `xml:"name,attr" json:"name" yaml:"name"`
+		Type        string   `xml:"type,attr" json:"type" yaml:"type"`
+		Required    bool     `xml:"required,attr" json:"required" yaml:"required"`
+		Default     string   `xml:"default,attr" json:"default" yaml:"default"`
+		Min         *float64 `xml:"min,attr" json:"min" yaml:"min"`
+		Max         *float64 `xml:"max,attr" json:"max" yaml:"max"`
+		Pattern     string   `xml:"pattern,attr" json:"pattern" yaml:"pattern"`
+		Layout      string   `xml:"layout,attr" json:"layout" yaml:"layout"`
+		Description string   `xml:",chardata" json:"description" yaml:"description"`
+	}
+	// FeedModle 声明该规则为Feed规则，如 <Feed detail="article"/>，先于ParseFunc执行
+	FeedModle struct {
+		Detail string `xml:"detail,attr" json:"detail" yaml:"detail"`
+	}
+	// ProcessModle 字段处理链，如 <Process field="title">trim|cleanhtml</Process>，field为空或*时作用于全部字段
+	ProcessModle struct {
+		Field string `xml:"field,attr" json:"field" yaml:"field"`
+		Chain string `xml:",chardata" json:"chain" yaml:"chain"`
+	}
+	// ItemsModle 每个匹配节点输出一条数据，未声明时整个页面输出一条
+	ItemsModle struct {
+		Css   string `xml:"css,attr" json:"css" yaml:"css"`
+		Xpath string `xml:"xpath,attr" json:"xpath" yaml:"xpath"`
+	}
+	// FieldModle 声明式抽取字段，css与xpath二选一，均为空时取Items节点本身
+	FieldModle struct {
+		Name     string `xml:"name,attr" json:"name" yaml:"name"` // 输出字段名，为空时仅用于follow
+		Css      string `xml:"css,attr" json:"css" yaml:"css"`
+		Xpath    string `xml:"xpath,attr" json:"xpath" yaml:"xpath"`
+		Attr     string `xml:"attr,attr" json:"attr" yaml:"attr"`             // text(默认)、html、outerhtml或属性名
+		Regex    string `xml:"regex,attr" json:"regex" yaml:"regex"`          // 对取值再过滤，有分组时取第一个分组
+		Follow   string `xml:"follow,attr" json:"follow" yaml:"follow"`       // 将取值作为链接，以该规则加入队列
+		Multiple bool   `xml:"multiple,attr" json:"multiple" yaml:"multiple"` // 输出全部匹配值的数组
+		Process  string `xml:"process,attr" json:"process" yaml:"process"`    // 该字段的处理链，如 trim|absurl
 	}
 )
 
 func init() {
-	for _, _m := range getSpiderModles() {
-		m := _m 
-		var sp = &Spider{
-			Name:            m.Name,
-			Description:     m.Description,
-			Pausetime:       m.Pausetime,
-			EnableCookie:    m.EnableCookie,
-			NotDefaultField: m.NotDefaultField,
-			RuleTree:        &RuleTree{Trunk: map[string]*Rule{}},
-		}
-		if m.EnableLimit {
-			sp.Limit = LIMIT
-		}
-		if m.EnableKeyin {
-			sp.Keyin = KEYIN
-		}
-		if m.Namespace != "" {
-			sp.Namespace = func(self *Spider) string {
-				vm := otto.New()
-				vm.Set("self", self)
-				val, err := vm.Eval(m.Namespace)
-				if err != nil {
-					logs.Log.Error(" *     动态规则  [Namespace]: %v\n", err)
-				}
-				s, _ := val.ToString()
-				return s
+	for _, m := range getSpiderModles() {
+		sp, err := m.Spider()
+		if err != nil {
+			logs.Log.Error(" *     动态规则  [%s]: %v\n", m.file, err)
+			continue
+		}
+		dynamicSpiders.loaded(m.file, sp.Register().GetName())
+	}
+}
+
+// Spider 将动态规则编译为蜘蛛，脚本预编译并共用同一虚拟机池
+func (m *SpiderModle) Spider() (*Spider, error) {
+	var sp = &Spider{
+		Name:            m.Name,
+		Description:     m.Description,
+		Pausetime:       m.Pausetime,
+		EnableCookie:    m.EnableCookie,
+		Profile:         m.Profile,
+		StickyProxy:     m.StickyProxy,
+		NotDefaultField: m.NotDefaultField,
+		RuleTree:        &RuleTree{Trunk: map[string]*Rule{}},
+	}
+	if m.EnableLimit {
+		sp.Limit = LIMIT
+	}
+	if m.EnableKeyin {
+		sp.Keyin = KEYIN
+	}
+	for _, p := range m.Params {
+		param := &Param{Description: strings.TrimSpace(p.Description)}
+		param.Name, param.Type, param.Required = p.Name, p.Type, p.Required
+		param.Min, param.Max, param.Pattern, param.Layout = p.Min, p.Max, p.Pattern, p.Layout
+		if p.Default != "" {
+			param.Default = p.Default
+		}
+		if param.Pattern != "" {
+			if _, err := regexp.Compile(param.Pattern); err != nil {
+				return nil, fmt.Errorf("Param %s: %v", p.Name, err)
 			}
 		}
-		if m.SubNamespace != "" {
-			sp.SubNamespace = func(self *Spider, dataCell map[string]interface{}) string {
-				vm := otto.New()
-				vm.Set("self", self)
-				vm.Set("dataCell", dataCell)
-				val, err := vm.Eval(m.SubNamespace)
-				if err != nil {
-					logs.Log.Error(" *     动态规则  [SubNamespace]: %v\n", err)
-				}
-				s, _ := val.ToString()
-				return s
+		sp.Params = append(sp.Params, param)
+	}
+	js := newJsRuntime(m.Name, time.Duration(m.Timeout)*time.Millisecond)
+
+	namespace, err := js.compile("Namespace", m.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != nil {
+		sp.Namespace = func(self *Spider) string {
+			s, err := js.runString(namespace, map[string]interface{}{"self": self})
+			if err != nil {
+				logs.Log.Error(" *     动态规则  [Namespace]: %v\n", err)
 			}
+			return s
 		}
-		sp.RuleTree.Root = func(ctx *Context) {
-			vm := otto.New()
-			vm.Set("ctx", ctx)
-			_, err := vm.Eval(m.Root)
+	}
+	subNamespace, err := js.compile("SubNamespace", m.SubNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if subNamespace != nil {
+		sp.SubNamespace = func(self *Spider, dataCell map[string]interface{}) string {
+			s, err := js.runString(subNamespace, map[string]interface{}{"self": self, "dataCell": dataCell})
 			if err != nil {
-				logs.Log.Error(" *     动态规则  [Root]: %v\n", err)
+				logs.Log.Error(" *     动态规则  [SubNamespace]: %v\n", err)
 			}
+			return s
 		}
-		for _, rule := range m.Trunk {
-			r := new(Rule)
-			r.ParseFunc = func(parse string) func(*Context) {
-				return func(ctx *Context) {
-					vm := otto.New()
-					vm.Set("ctx", ctx)
-					_, err := vm.Eval(parse)
-					if err != nil {
-						logs.Log.Error(" *     动态规则  [ParseFunc]: %v\n", err)
-					}
+	}
+	root, err := js.compile("Root", m.Root)
+	if err != nil {
+		return nil, err
+	}
+	sp.RuleTree.Root = func(ctx *Context) {
+		if root == nil {
+			return
+		}
+		if _, err := js.run(root, map[string]interface{}{"ctx": ctx}); err != nil {
+			logs.Log.Error(" *     动态规则  [Root]: %v\n", err)
+		}
+	}
+	if err = m.hooks(sp, js); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range m.Trunk {
+		r := new(Rule)
+		var ex *extractor
+		if len(rule.Fields) > 0 {
+			if ex, err = newExtractor(rule); err != nil {
+				return nil, err
+			}
+			r.ItemFields = ex.names()
+		}
+		if r.Processors, err = rule.processors(); err != nil {
+			return nil, err
+		}
+		feed := rule.Feed
+		if feed != nil {
+			r.ItemFields = append(append([]string(nil), feedFields...), r.ItemFields...)
+		}
+		parse, err := js.compile(rule.Name+".ParseFunc", rule.ParseFunc)
+		if err != nil {
+			return nil, err
+		}
+		aid, err := js.compile(rule.Name+".AidFunc", rule.AidFunc)
+		if err != nil {
+			return nil, err
+		}
+		r.ParseFunc = func(ctx *Context) {
+			if feed != nil {
+				ctx.ParseFeed(feed.Detail)
+			}
+			if ex != nil {
+				ex.run(ctx, ctx.htmlRoot())
+			}
+			if parse == nil {
+				return
+			}
+			if _, err := js.run(parse, map[string]interface{}{"ctx": ctx}); err != nil {
+				if _, ok := err.(*JsTimeoutError); ok {
+					// 超时视为本次请求失败
+					panic(err)
 				}
-			}(rule.ParseFunc)
-			r.AidFunc = func(parse string) func(*Context, map[string]interface{}) interface{} {
-				return func(ctx *Context, aid map[string]interface{}) interface{} {
-					vm := otto.New()
-					vm.Set("ctx", ctx)
-					vm.Set("aid", aid)
-					val, err := vm.Eval(parse)
-					if err != nil {
-						logs.Log.Error(" *     动态规则  [AidFunc]: %v\n", err)
+				logs.Log.Error(" *     动态规则  [ParseFunc]: %v\n", err)
+			}
+		}
+		if aid != nil {
+			r.AidFunc = func(ctx *Context, aidMap map[string]interface{}) interface{} {
+				val, err := js.run(aid, map[string]interface{}{"ctx": ctx, "aid": aidMap})
+				if err != nil {
+					if _, ok := err.(*JsTimeoutError); ok {
+						panic(err)
 					}
-					return val
+					logs.Log.Error(" *     动态规则  [AidFunc]: %v\n", err)
 				}
-			}(rule.AidFunc)
-			sp.RuleTree.Trunk[rule.Name] = r
+				return val
+			}
 		}
-		sp.Register()
+		sp.RuleTree.Trunk[rule.Name] = r
 	}
+	return sp, nil
 }
 
 func getSpiderModles() (ms []*SpiderModle) {
@@ -117,20 +235,115 @@ func getSpiderModles() (ms []*SpiderModle) {
 			log.Printf("[E] HTML动态规则解析: %v\n", p)
 		}
 	}()
-	files, _ := filepath.Glob(path.Join(config.SPIDER_DIR, "*"+config.SPIDER_EXT))
-	for _, filename := range files {
-		b, err := ioutil.ReadFile(filename)
+	for _, filename := range spiderFiles() {
+		m, err := ParseSpiderFile(filename)
 		if err != nil {
-			log.Printf("[E] HTML动态规则[%s]: %v\n", filename, err)
+			log.Printf("[E] HTML动态规则: %v\n", err)
 			continue
 		}
-		var m SpiderModle
-		err = xml.Unmarshal(b, &m)
+		ms = append(ms, m)
+	}
+	return
+}
+
+// hooks 编译生命周期脚本
+func (m *SpiderModle) hooks(sp *Spider, js *jsRuntime) error {
+	onStart, err := js.compile("OnStart", m.OnStart)
+	if err != nil {
+		return err
+	}
+	onFinish, err := js.compile("OnFinish", m.OnFinish)
+	if err != nil {
+		return err
+	}
+	onItem, err := js.compile("OnItem", m.OnItem)
+	if err != nil {
+		return err
+	}
+	onError, err := js.compile("OnError", m.OnError)
+	if err != nil {
+		return err
+	}
+	if onStart != nil {
+		sp.OnStart = func(ctx *Context) error {
+			val, err := js.run(onStart, map[string]interface{}{"ctx": ctx})
+			if err != nil {
+				return err
+			}
+			if ok, isBool := val.(bool); isBool && !ok {
+				return fmt.Errorf("OnStart 返回 false")
+			}
+			return nil
+		}
+	}
+	if onFinish != nil {
+		sp.OnFinish = func(self *Spider, stat SpiderStat) {
+			if _, err := js.run(onFinish, map[string]interface{}{"self": self, "stat": stat}); err != nil {
+				logs.Log.Error(" *     动态规则  [OnFinish]: %v\n", err)
+			}
+		}
+	}
+	if onItem != nil {
+		sp.OnItem = func(ctx *Context, ruleName string, item map[string]interface{}) map[string]interface{} {
+			val, err := js.run(onItem, map[string]interface{}{"ctx": ctx, "rule": ruleName, "item": item})
+			if err != nil {
+				logs.Log.Error(" *     动态规则  [OnItem]: %v\n", err)
+				return item
+			}
+			switch v := val.(type) {
+			case bool:
+				if !v {
+					return nil
+				}
+			case map[string]interface{}:
+				return v
+			}
+			return item
+		}
+	}
+	if onError != nil {
+		sp.OnError = func(self *Spider, req *request.Request, reqErr error) {
+			vars := map[string]interface{}{"self": self, "req": req, "err": reqErr.Error()}
+			if _, err := js.run(onError, vars); err != nil {
+				logs.Log.Error(" *     动态规则  [OnError]: %v\n", err)
+			}
+		}
+	}
+	return nil
+}
+
+// processors 汇总Process与Field中声明的处理链
+func (m RuleModle) processors() (map[string][]Processor, error) {
+	var ps map[string][]Processor
+	add := func(field, chain string) error {
+		if field == "" {
+			field = ALL_FIELDS
+		}
+		p, err := ParseProcessors(chain)
 		if err != nil {
-			log.Printf("[E] HTML动态规则[%s]: %v\n", filename, err)
+			return fmt.Errorf("rule %s: Process %s: %v", m.Name, field, err)
+		}
+		if len(p) == 0 {
+			return nil
+		}
+		if ps == nil {
+			ps = make(map[string][]Processor)
+		}
+		ps[field] = append(ps[field], p...)
+		return nil
+	}
+	for _, p := range m.Processes {
+		if err := add(p.Field, p.Chain); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range m.Fields {
+		if f.Name == "" || f.Process == "" {
 			continue
 		}
-		ms = append(ms, &m)
+		if err := add(f.Name, f.Process); err != nil {
+			return nil, err
+		}
 	}
-	return
-}
\ No newline at end of file
+	return ps, nil
+}
@@ -0,0 +1,329 @@
+package spider
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Processor 在Context.Output中处理单个字段的值，返回错误时该条数据作为无效数据输出至rejects
+	Processor func(ctx *Context, v interface{}) (interface{}, error)
+	// ProcessorFactory 根据参数（名称后冒号之后的部分，可为空）创建Processor
+	ProcessorFactory func(arg string) (Processor, error)
+)
+
+// ALL_FIELDS Rule.Processors中作用于全部字段的键，先于字段自身的处理器执行
+const ALL_FIELDS = "*"
+
+var processors = struct {
+	m map[string]ProcessorFactory
+	sync.RWMutex
+}{m: map[string]ProcessorFactory{}}
+
+// RegisterProcessor 注册可在处理链中按名称引用的处理器，同名覆盖
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processors.Lock()
+	processors.m[name] = factory
+	processors.Unlock()
+}
+
+// ParseProcessors 解析形如 "trim|replace:a=>b|date:2006-01-02" 的处理链，参数中的|写作\|
+func ParseProcessors(chain string) ([]Processor, error) {
+	var ps []Processor
+	for _, spec := range splitChain(chain) {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, arg := spec, ""
+		if i := strings.Index(spec, ":"); i >= 0 {
+			name, arg = spec[:i], spec[i+1:]
+		}
+		processors.RLock()
+		factory, ok := processors.m[name]
+		processors.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown processor %q", name)
+		}
+		p, err := factory(arg)
+		if err != nil {
+			return nil, fmt.Errorf("processor %s: %v", name, err)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func splitChain(chain string) []string {
+	var (
+		parts []string
+		cur   []byte
+	)
+	for i := 0; i < len(chain); i++ {
+		switch {
+		case chain[i] == '\\' && i+1 < len(chain) && chain[i+1] == '|':
+			cur = append(cur, '|')
+			i++
+		case chain[i] == '|':
+			parts = append(parts, string(cur))
+			cur = cur[:0]
+		default:
+			cur = append(cur, chain[i])
+		}
+	}
+	return append(parts, string(cur))
+}
+
+// process 对数据的每个字段依次执行ALL_FIELDS与字段自身的处理链，返回处理后的新数据
+func (self *Rule) process(ctx *Context, item map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	for k := range self.Processors {
+		if _, ok := out[k]; !ok && k != ALL_FIELDS {
+			out[k] = nil
+		}
+	}
+	for k, v := range out {
+		var err error
+		for _, chain := range [][]Processor{self.Processors[ALL_FIELDS], self.Processors[k]} {
+			for _, p := range chain {
+				if v, err = p(ctx, v); err != nil {
+					return nil, fmt.Errorf("字段 %s: %v", k, err)
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// StringProcessor 将字符串处理函数包装为Processor，列表逐项处理，nil与其他类型原样返回
+func StringProcessor(f func(ctx *Context, s string) (string, error)) Processor {
+	var p Processor
+	p = func(ctx *Context, v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case string:
+			return f(ctx, v)
+		case []string:
+			out := make([]string, len(v))
+			for i, s := range v {
+				var err error
+				if out[i], err = f(ctx, s); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		case []interface{}:
+			out := make([]interface{}, len(v))
+			for i, e := range v {
+				var err error
+				if out[i], err = p(ctx, e); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		}
+		return v, nil
+	}
+	return p
+}
+
+func simple(f func(string) string) ProcessorFactory {
+	return func(string) (Processor, error) {
+		return StringProcessor(func(_ *Context, s string) (string, error) {
+			return f(s), nil
+		}), nil
+	}
+}
+
+var (
+	cleanHtmlRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`<[\S\s]+?>`),
+		regexp.MustCompile(`<style[\S\s]+?</style>`),
+		regexp.MustCompile(`<script[\S\s]+?</script>`),
+		regexp.MustCompile(`<[\S\s]+?>`),
+		regexp.MustCompile(`\s{2,}`),
+	}
+	depriveReplacer = strings.NewReplacer("\n", "", "\r", "", "\t", "", " ", "")
+)
+
+// cleanHtml 与common.CleanHtml相同：depth依次为标签转小写、去style、去script、去标签、合并空白
+func cleanHtml(s string, depth int) string {
+	if depth > 0 {
+		s = cleanHtmlRegexps[0].ReplaceAllStringFunc(s, strings.ToLower)
+	}
+	if depth > 1 {
+		s = cleanHtmlRegexps[1].ReplaceAllString(s, "")
+	}
+	if depth > 2 {
+		s = cleanHtmlRegexps[2].ReplaceAllString(s, "")
+	}
+	if depth > 3 {
+		s = cleanHtmlRegexps[3].ReplaceAllString(s, "\n")
+	}
+	if depth > 4 {
+		s = cleanHtmlRegexps[4].ReplaceAllString(s, "\n")
+	}
+	return strings.TrimSpace(s)
+}
+
+func init() {
+	RegisterProcessor("trim", simple(strings.TrimSpace))
+	RegisterProcessor("lower", simple(strings.ToLower))
+	RegisterProcessor("upper", simple(strings.ToUpper))
+	RegisterProcessor("unescape", simple(html.UnescapeString))
+	// deprive 与common.Deprive相同，去除全部换行、制表符与空格
+	RegisterProcessor("deprive", simple(depriveReplacer.Replace))
+
+	// cleanhtml[:depth] 默认depth为5
+	RegisterProcessor("cleanhtml", func(arg string) (Processor, error) {
+		depth := 5
+		if arg != "" {
+			var err error
+			if depth, err = strconv.Atoi(arg); err != nil {
+				return nil, err
+			}
+		}
+		return StringProcessor(func(_ *Context, s string) (string, error) {
+			return cleanHtml(s, depth), nil
+		}), nil
+	})
+
+	// replace:旧值=>新值
+	RegisterProcessor("replace", func(arg string) (Processor, error) {
+		parts := strings.SplitN(arg, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("usage: replace:old=>new")
+		}
+		return StringProcessor(func(_ *Context, s string) (string, error) {
+			return strings.Replace(s, parts[0], parts[1], -1), nil
+		}), nil
+	})
+
+	// regex:表达式 取第一个分组（无分组时取整个匹配），不匹配时为空
+	RegisterProcessor("regex", func(arg string) (Processor, error) {
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return StringProcessor(func(_ *Context, s string) (string, error) {
+			m := re.FindStringSubmatch(s)
+			switch len(m) {
+			case 0:
+				return "", nil
+			case 1:
+				return m[0], nil
+			}
+			return m[1], nil
+		}), nil
+	})
+
+	// date[:layout] 解析时间并统一为TIME_LAYOUT格式，空值跳过
+	RegisterProcessor("date", func(arg string) (Processor, error) {
+		f := &SchemaField{Layout: arg}
+		return StringProcessor(func(_ *Context, s string) (string, error) {
+			if strings.TrimSpace(s) == "" {
+				return s, nil
+			}
+			t, err := f.toTime(s)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(TIME_LAYOUT), nil
+		}), nil
+	})
+
+	// absurl 将相对链接转为以当前页面为基准的绝对链接
+	RegisterProcessor("absurl", func(string) (Processor, error) {
+		return StringProcessor(func(ctx *Context, s string) (string, error) {
+			s = strings.TrimSpace(s)
+			if s == "" || ctx == nil {
+				return s, nil
+			}
+			base, err := url.Parse(ctx.GetUrl())
+			if err != nil {
+				return s, nil
+			}
+			u, err := base.Parse(s)
+			if err != nil {
+				return s, nil
+			}
+			return u.String(), nil
+		}), nil
+	})
+
+	// default:值 字段缺失或为空字符串时取该值
+	RegisterProcessor("default", func(arg string) (Processor, error) {
+		return func(_ *Context, v interface{}) (interface{}, error) {
+			if isEmpty(v) {
+				return arg, nil
+			}
+			return v, nil
+		}, nil
+	})
+
+	// int、float 转为数值，空值跳过
+	RegisterProcessor("int", func(string) (Processor, error) {
+		return func(_ *Context, v interface{}) (interface{}, error) {
+			if isEmpty(v) {
+				return v, nil
+			}
+			return toInt(v, true)
+		}, nil
+	})
+	RegisterProcessor("float", func(string) (Processor, error) {
+		return func(_ *Context, v interface{}) (interface{}, error) {
+			if isEmpty(v) {
+				return v, nil
+			}
+			return toFloat(v)
+		}, nil
+	})
+
+	// split:分隔符 将字符串拆分为列表并去除空项，默认以逗号分隔
+	RegisterProcessor("split", func(arg string) (Processor, error) {
+		if arg == "" {
+			arg = ","
+		}
+		return func(_ *Context, v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return v, nil
+			}
+			var list []string
+			for _, e := range strings.Split(s, arg) {
+				if e = strings.TrimSpace(e); e != "" {
+					list = append(list, e)
+				}
+			}
+			return list, nil
+		}, nil
+	})
+
+	// join:分隔符 将列表合并为字符串，默认以逗号分隔
+	RegisterProcessor("join", func(arg string) (Processor, error) {
+		if arg == "" {
+			arg = ","
+		}
+		return func(_ *Context, v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case []string:
+				return strings.Join(v, arg), nil
+			case []interface{}:
+				strs := make([]string, len(v))
+				for i, e := range v {
+					strs[i] = fmt.Sprint(e)
+				}
+				return strings.Join(strs, arg), nil
+			}
+			return v, nil
+		}, nil
+	})
+}
@@ -0,0 +1,69 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRuleProcess(t *testing.T) {
+	chain := func(s string) []Processor {
+		ps, err := ParseProcessors(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ps
+	}
+	rule := &Rule{Processors: map[string][]Processor{
+		ALL_FIELDS: chain("trim"),
+		"title":    chain("cleanhtml|replace:Go=>Golang"),
+		"price":    chain(`regex:(\d+)|int`),
+		"tags":     chain("split:\\||upper"),
+		"state":    chain("default:new"),
+	}}
+	got, err := rule.process(nil, map[string]interface{}{
+		"title": " <b>Go</b> ",
+		"price": "售价 12 元",
+		"tags":  "a| b |",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title": "Golang",
+		"price": int64(12),
+		"tags":  []string{"A", "B"},
+		"state": "new",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	rule = &Rule{Processors: map[string][]Processor{"date": chain("date:2006-01-02")}}
+	if _, err := rule.process(nil, map[string]interface{}{"date": "yesterday"}); err == nil {
+		t.Error("expected an error for an unparsable date")
+	}
+	if _, err := ParseProcessors("nosuch"); err == nil {
+		t.Error("expected an error for an unknown processor")
+	}
+}
+
+func TestIntProcessor(t *testing.T) {
+	ps, err := ParseProcessors("int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v, want := range map[interface{}]int64{
+		"9007199254740993": 1<<53 + 1,
+		int64(1<<53 + 1):   1<<53 + 1,
+		"12.9":             12,
+		"1,024":            1024,
+		uint64(1<<53 + 1):  1<<53 + 1,
+	} {
+		if got, err := ps[0](nil, v); err != nil || got != want {
+			t.Errorf("%#v: got %v, %v, want %d", v, got, err, want)
+		}
+	}
+	if _, err := ps[0](nil, "abc"); err == nil {
+		t.Error("want error for a non-numeric value")
+	}
+}
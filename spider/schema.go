@@ -0,0 +1,370 @@
+package spider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 字段类型
+const (
+	FIELD_STRING = "string"
+	FIELD_INT    = "int"
+	FIELD_FLOAT  = "float"
+	FIELD_TIME   = "time"
+	FIELD_BOOL   = "bool"
+	FIELD_LIST   = "list"
+)
+
+const (
+	// REJECTS_SUFFIX 未通过校验的数据输出至"规则名__rejects"
+	REJECTS_SUFFIX = "__rejects"
+	// REJECT_REASON 被拒数据中记录原因的字段
+	REJECT_REASON = "RejectReason"
+	// TIME_LAYOUT time类型字段统一输出的格式
+	TIME_LAYOUT = "2006-01-02 15:04:05"
+)
+
+// 未指定Layout时依次尝试的时间格式
+var TimeLayouts = []string{
+	TIME_LAYOUT,
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"2006年01月02日 15:04",
+	"2006年01月02日",
+}
+
+// SchemaField 规则的类型化字段声明
+type SchemaField struct {
+	Name     string
+	Type     string      // 默认为string
+	Required bool        // 缺失、nil或空字符串时拒绝
+	Default  interface{} // 非必填字段缺失时的取值
+	Min      *float64    // 数值的下限，string与list为长度下限
+	Max      *float64    // 数值的上限，string与list为长度上限
+	Pattern  string      // string须匹配的正则
+	Enum     []string    // string的可选值
+	Layout   string      // time的解析格式，为空时依次尝试TimeLayouts
+	pattern  *regexp.Regexp
+}
+
+// Limit 便于声明Min、Max
+func Limit(f float64) *float64 {
+	return &f
+}
+
+// prepareSchemas 编译规则的字段声明，并为声明了Schema或Processors的规则创建被拒数据的输出规则，可重复调用
+func (self *Spider) prepareSchemas() error {
+	if self.RuleTree == nil {
+		return nil
+	}
+	for name, rule := range self.RuleTree.Trunk {
+		if len(rule.Schema)+len(rule.Processors) == 0 || strings.HasSuffix(name, REJECTS_SUFFIX) {
+			continue
+		}
+		for _, f := range rule.Schema {
+			if err := f.prepare(); err != nil {
+				return fmt.Errorf("规则 %s: %v", name, err)
+			}
+			self.UpsertItemField(rule, f.Name)
+		}
+		for k := range rule.Processors {
+			if k != ALL_FIELDS {
+				self.UpsertItemField(rule, k)
+			}
+		}
+		if _, ok := self.RuleTree.Trunk[name+REJECTS_SUFFIX]; ok {
+			continue
+		}
+		rejects := &Rule{}
+		rejects.ItemFields = append(rejects.ItemFields, rule.ItemFields...)
+		rejects.ItemFields = append(rejects.ItemFields, REJECT_REASON)
+		self.RuleTree.Trunk[name+REJECTS_SUFFIX] = rejects
+	}
+	return nil
+}
+
+// SchemaField 返回规则中指定名称的字段声明
+func (self *Rule) SchemaField(name string) *SchemaField {
+	for _, f := range self.Schema {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// validate 按字段声明转换数据类型并校验，返回转换后的新数据；未声明的字段原样保留
+func (self *Rule) validate(item map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	for _, f := range self.Schema {
+		v, err := f.coerce(item[f.Name])
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %v", f.Name, err)
+		}
+		out[f.Name] = v
+	}
+	return out, nil
+}
+
+func (self *SchemaField) coerce(v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		if self.Required {
+			return nil, fmt.Errorf("为必填项")
+		}
+		if self.Default != nil {
+			v = self.Default
+		} else {
+			return self.zero(), nil
+		}
+	}
+	switch self.Type {
+	case FIELD_INT:
+		i, err := toInt(v, false)
+		if err != nil {
+			return nil, err
+		}
+		if err = self.checkRange(float64(i), "值"); err != nil {
+			return nil, err
+		}
+		return i, nil
+
+	case FIELD_FLOAT:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if err = self.checkRange(f, "值"); err != nil {
+			return nil, err
+		}
+		return f, nil
+
+	case FIELD_BOOL:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(b)) {
+			case "1", "t", "true", "yes", "y", "on", "是":
+				return true, nil
+			case "0", "f", "false", "no", "n", "off", "否":
+				return false, nil
+			}
+		default:
+			if f, err := toFloat(v); err == nil {
+				return f != 0, nil
+			}
+		}
+		return nil, fmt.Errorf("%v 不是布尔值", v)
+
+	case FIELD_TIME:
+		t, err := self.toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(TIME_LAYOUT), nil
+
+	case FIELD_LIST:
+		var list []interface{}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			for i := 0; i < rv.Len(); i++ {
+				list = append(list, rv.Index(i).Interface())
+			}
+		} else {
+			list = []interface{}{v}
+		}
+		if err := self.checkRange(float64(len(list)), "长度"); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if err := self.checkRange(float64(utf8.RuneCountInString(s)), "长度"); err != nil {
+		return nil, err
+	}
+	if self.pattern != nil && !self.pattern.MatchString(s) {
+		return nil, fmt.Errorf("%q 不匹配 %s", s, self.Pattern)
+	}
+	if len(self.Enum) > 0 {
+		var ok bool
+		for _, e := range self.Enum {
+			if e == s {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%q 不在可选值 %v 中", s, self.Enum)
+		}
+	}
+	return s, nil
+}
+
+// zero 非必填字段缺失且无默认值时的取值，time为nil
+func (self *SchemaField) zero() interface{} {
+	switch self.Type {
+	case FIELD_INT:
+		return int64(0)
+	case FIELD_FLOAT:
+		return float64(0)
+	case FIELD_BOOL:
+		return false
+	case FIELD_LIST:
+		return []interface{}{}
+	case FIELD_TIME:
+		return nil
+	}
+	return ""
+}
+
+func (self *SchemaField) checkRange(f float64, what string) error {
+	if self.Min != nil && f < *self.Min {
+		return fmt.Errorf("%s %v 小于 %v", what, f, *self.Min)
+	}
+	if self.Max != nil && f > *self.Max {
+		return fmt.Errorf("%s %v 大于 %v", what, f, *self.Max)
+	}
+	return nil
+}
+
+func (self *SchemaField) toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		t = strings.TrimSpace(t)
+		layouts := TimeLayouts
+		if self.Layout != "" {
+			layouts = []string{self.Layout}
+		}
+		for _, layout := range layouts {
+			if tm, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return tm, nil
+			}
+		}
+		if sec, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return time.Unix(sec, 0), nil
+		}
+		return time.Time{}, fmt.Errorf("%q 不是有效的时间", t)
+	}
+	if f, err := toFloat(v); err == nil {
+		return time.Unix(int64(f), 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%v 不是有效的时间", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint:
+		return float64(n), nil
+	case uint32:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		s := strings.Replace(strings.TrimSpace(n), ",", "", -1)
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%v 不是数值", v)
+}
+
+// toInt 转换为整数，整数类型、json.Number与整数字符串不经float64转换，以免超过2^53的整数失真；
+// 其余数值的小数部分在trunc为true时舍去，否则返回错误
+func toInt(v interface{}, trunc bool) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return toInt(uint64(n), trunc)
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, fmt.Errorf("%v 超出整数范围", v)
+		}
+		return int64(n), nil
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	case string:
+		s := strings.Replace(strings.TrimSpace(n), ",", "", -1)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	if !trunc && f != math.Trunc(f) {
+		return 0, fmt.Errorf("%v 不是整数", v)
+	}
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("%v 超出整数范围", v)
+	}
+	return int64(f), nil
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	}
+	return false
+}
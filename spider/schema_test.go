@@ -0,0 +1,125 @@
+package spider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleValidate(t *testing.T) {
+	sp := &Spider{RuleTree: &RuleTree{Trunk: map[string]*Rule{
+		"item": {Schema: []*SchemaField{
+			{Name: "title", Required: true, Max: Limit(10)},
+			{Name: "price", Type: FIELD_FLOAT, Min: Limit(0)},
+			{Name: "stock", Type: FIELD_INT},
+			{Name: "online", Type: FIELD_BOOL},
+			{Name: "date", Type: FIELD_TIME},
+			{Name: "tags", Type: FIELD_LIST},
+			{Name: "state", Enum: []string{"new", "used"}, Default: "new"},
+		}},
+	}}}
+	if err := sp.prepareSchemas(); err != nil {
+		t.Fatal(err)
+	}
+	rule := sp.MustGetRule("item")
+	if _, ok := sp.GetRule("item" + REJECTS_SUFFIX); !ok {
+		t.Fatal("rejects rule was not created")
+	}
+
+	got, err := rule.validate(map[string]interface{}{
+		"title":  "Go",
+		"price":  "1,299.5",
+		"stock":  json.Number("3"),
+		"online": "yes",
+		"date":   "2020-01-02",
+		"tags":   []string{"a", "b"},
+		"extra":  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"title":  "Go",
+		"price":  1299.5,
+		"stock":  int64(3),
+		"online": true,
+		"date":   "2020-01-02 00:00:00",
+		"tags":   []interface{}{"a", "b"},
+		"state":  "new",
+		"extra":  1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	for field, item := range map[string]map[string]interface{}{
+		"title": {"price": 1},
+		"price": {"title": "Go", "price": -1},
+		"stock": {"title": "Go", "stock": 1.5},
+		"state": {"title": "Go", "state": "old"},
+	} {
+		if _, err := rule.validate(item); err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("%v: got error %v, want one about %s", item, err, field)
+		}
+	}
+}
+
+func TestCoerceBigInt(t *testing.T) {
+	f := &SchemaField{Name: "id", Type: FIELD_INT}
+	const big = int64(1<<53 + 1)
+	for _, v := range []interface{}{big, uint64(big), json.Number("9007199254740993"), "9007199254740993", "9,007,199,254,740,993"} {
+		if got, err := f.coerce(v); err != nil || got != big {
+			t.Errorf("%#v: got %v, %v", v, got, err)
+		}
+	}
+	for _, v := range []interface{}{uint64(1 << 63), "1.5", 2.5} {
+		if got, err := f.coerce(v); err == nil {
+			t.Errorf("%#v: got %v, want error", v, got)
+		}
+	}
+	if got, err := f.coerce("3.0"); err != nil || got != int64(3) {
+		t.Errorf("3.0: got %v, %v", got, err)
+	}
+}
+
+func TestPrepareSchemasError(t *testing.T) {
+	sp := &Spider{Name: "bad", RuleTree: &RuleTree{Trunk: map[string]*Rule{
+		"item": {Schema: []*SchemaField{{Name: "code", Pattern: "(["}}},
+	}}}
+	if err := sp.prepareSchemas(); err == nil {
+		t.Error("want error for invalid pattern")
+	}
+	typo := &Spider{Name: "typo", RuleTree: &RuleTree{Trunk: map[string]*Rule{
+		"item": {Schema: []*SchemaField{{Name: "price", Type: "integer"}}},
+	}}}
+	if err := typo.prepareSchemas(); err == nil || !strings.Contains(err.Error(), "integer") {
+		t.Errorf("unknown type: %v", err)
+	}
+	if got := sp.Register(); Species.GetByName("bad") != nil || got == nil {
+		t.Error("spider with invalid schema was registered")
+	}
+}
+
+func TestOutputStat(t *testing.T) {
+	sp := newTestSpider(map[string]*Rule{
+		"test": {Schema: []*SchemaField{{Name: "title", Required: true}}},
+	})
+	if err := sp.prepareSchemas(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := newTestContext(sp, "http://example.com/", "text/html", "")
+	defer PutContext(ctx)
+	ctx.Output(map[string]interface{}{"title": "a"})
+	ctx.Output(map[string]interface{}{"title": "b"})
+	ctx.Output(map[string]interface{}{"title": ""})
+
+	stat := sp.Stat()
+	if stat.Items != 2 || stat.Rejects != 1 {
+		t.Errorf("Items = %d, Rejects = %d", stat.Items, stat.Rejects)
+	}
+	want := map[string]int64{"test": 2, "test" + REJECTS_SUFFIX: 1}
+	if !reflect.DeepEqual(stat.Rules, want) {
+		t.Errorf("Rules = %v, want %v", stat.Rules, want)
+	}
+}
@@ -0,0 +1,339 @@
+package spider
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-spider/downloader/request"
+	"go-spider/logs"
+)
+
+// 内部规则名，声明Sitemap时自动加入RuleTree.Trunk
+const (
+	SITEMAP_RULE = "__sitemap__"
+	ROBOTS_RULE  = "__robots__"
+)
+
+// 页面请求的Temp中记录的sitemap信息
+const (
+	SITEMAP_LASTMOD  = "SitemapLastmod"  // time.Time，未声明时不存在
+	SITEMAP_PRIORITY = "SitemapPriority" // float64，未声明时为0.5
+	// robots.txt请求的Temp中记录已改以 /sitemap.xml 播种，重试时不再重复加入
+	ROBOTS_FALLBACK = "__robots_fallback__"
+)
+
+type (
+	// Sitemap 以sitemap为蜘蛛播种，Spider.Start在Root之后将Urls加入队列
+	Sitemap struct {
+		// sitemap、sitemap索引或robots.txt的链接，站点根（如 http://example.com/）视为其robots.txt；
+		// robots.txt中未声明Sitemap或下载失败时尝试 /sitemap.xml
+		Urls   []string
+		Routes []*SitemapRoute // 按顺序匹配页面链接，首个匹配的路由决定解析规则
+		Rule   string          // 未匹配任何路由时的规则，为空则跳过
+		// 页面请求的优先级为 路由的Priority + sitemap中的priority(0~1，默认0.5) × PriorityScale
+		PriorityScale float64
+		Since         time.Time     // lastmod早于该时间的页面与子sitemap不再抓取
+		Recrawl       time.Duration // lastmod在该时长内的页面即使已抓取过也重新抓取
+		once          sync.Once
+		err           error
+	}
+	// SitemapRoute 页面链接匹配Pattern（正则）时以Rule规则抓取
+	SitemapRoute struct {
+		Pattern  string
+		Rule     string
+		Priority int
+		re       *regexp.Regexp
+	}
+
+	sitemapDoc struct {
+		XMLName  xml.Name
+		URLs     []sitemapEntry `xml:"url"`
+		Sitemaps []sitemapEntry `xml:"sitemap"`
+	}
+	sitemapEntry struct {
+		Loc      string `xml:"loc"`
+		Lastmod  string `xml:"lastmod"`
+		Priority string `xml:"priority"`
+	}
+)
+
+// W3C Datetime
+var lastmodLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// prepareSitemap 校验Sitemap的路由并为声明了Sitemap的蜘蛛加入内部规则，可重复调用
+func (self *Spider) prepareSitemap() error {
+	if self.Sitemap == nil || self.RuleTree == nil {
+		return nil
+	}
+	if err := self.Sitemap.compile(); err != nil {
+		return err
+	}
+	if self.RuleTree.Trunk == nil {
+		self.RuleTree.Trunk = make(map[string]*Rule)
+	}
+	for _, r := range self.Sitemap.Routes {
+		if _, ok := self.RuleTree.Trunk[r.Rule]; !ok {
+			return fmt.Errorf("Sitemap 路由 [%v]: 规则 %s 不存在", r.Pattern, r.Rule)
+		}
+	}
+	if rule := self.Sitemap.Rule; rule != "" {
+		if _, ok := self.RuleTree.Trunk[rule]; !ok {
+			return fmt.Errorf("Sitemap: 规则 %s 不存在", rule)
+		}
+	}
+	self.RuleTree.Trunk[SITEMAP_RULE] = &Rule{ParseFunc: parseSitemap}
+	self.RuleTree.Trunk[ROBOTS_RULE] = &Rule{ParseFunc: parseRobots}
+	return nil
+}
+
+// AddSitemap 将sitemap或robots.txt链接加入队列，规则取自蜘蛛的Sitemap声明
+func (self *Context) AddSitemap(urls ...string) *Context {
+	if self.spider.Sitemap == nil {
+		logs.Log.Error("蜘蛛 %s 未声明Sitemap", self.spider.GetName())
+		return self
+	}
+	for _, u := range urls {
+		rule := SITEMAP_RULE
+		if p, err := url.Parse(u); err == nil && (p.Path == "" || p.Path == "/") {
+			p.Path = "/robots.txt"
+			u = p.String()
+		}
+		if strings.HasSuffix(strings.ToLower(u), "/robots.txt") {
+			rule = ROBOTS_RULE
+		}
+		self.AddQueue(&request.Request{
+			Url:  u,
+			Rule: rule,
+			// sitemap本身每次都需重新获取
+			Reloadable: true,
+		})
+	}
+	return self
+}
+
+// compile 编译路由的正则，结果只计算一次
+func (self *Sitemap) compile() error {
+	self.once.Do(func() {
+		for _, r := range self.Routes {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				self.err = fmt.Errorf("Sitemap 路由 [%v]: %v", r.Pattern, err)
+				return
+			}
+			r.re = re
+		}
+	})
+	return self.err
+}
+
+// route 返回页面链接对应的规则与基础优先级
+func (self *Sitemap) route(link string) (string, int) {
+	self.compile()
+	for _, r := range self.Routes {
+		if r.re != nil && r.re.MatchString(link) {
+			return r.Rule, r.Priority
+		}
+	}
+	return self.Rule, 0
+}
+
+func parseRobots(ctx *Context) {
+	var found bool
+	scanner := bufio.NewScanner(strings.NewReader(ctx.GetText()))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 8 || !strings.EqualFold(line[:8], "sitemap:") {
+			continue
+		}
+		if u := strings.TrimSpace(line[8:]); u != "" {
+			found = true
+			ctx.AddSitemap(u)
+		}
+	}
+	if !found && !ctx.GetTemp(ROBOTS_FALLBACK, false).(bool) {
+		ctx.addDefaultSitemap()
+	}
+}
+
+// addDefaultSitemap 以当前robots.txt所在站点的 /sitemap.xml 播种
+func (self *Context) addDefaultSitemap() {
+	if u, err := url.Parse(self.GetUrl()); err == nil {
+		u.Path, u.RawQuery = "/sitemap.xml", ""
+		self.AddSitemap(u.String())
+	}
+}
+
+// robotsFailed robots.txt下载失败（如404）时ParseFunc不会执行，同样尝试 /sitemap.xml
+func (self *Spider) robotsFailed(req *request.Request) {
+	if self.Sitemap == nil || req.GetRuleName() != ROBOTS_RULE || self.IsStopping() {
+		return
+	}
+	if req.GetTemp(ROBOTS_FALLBACK, false).(bool) {
+		return
+	}
+	req.SetTemp(ROBOTS_FALLBACK, true)
+	ctx := GetContext(self, req)
+	defer PutContext(ctx)
+	ctx.addDefaultSitemap()
+}
+
+func parseSitemap(ctx *Context) {
+	sm := ctx.spider.Sitemap
+	body, decoded, err := sitemapBody(ctx)
+	if err != nil {
+		logs.Log.Error(" *     Sitemap [%v]: %v\n", ctx.GetUrl(), err)
+		return
+	}
+	doc, err := decodeSitemap(body, decoded)
+	if err != nil {
+		logs.Log.Error(" *     Sitemap [%v]: %v\n", ctx.GetUrl(), err)
+		return
+	}
+	base, _ := url.Parse(ctx.GetUrl())
+	for _, e := range doc.Sitemaps {
+		if link := e.resolve(base); link != "" && !e.stale(sm) {
+			ctx.AddSitemap(link)
+		}
+	}
+	scale := sm.PriorityScale
+	if scale == 0 {
+		scale = 10
+	}
+	for _, e := range doc.URLs {
+		link := e.resolve(base)
+		if link == "" || e.stale(sm) {
+			continue
+		}
+		rule, priority := sm.route(link)
+		if rule == "" {
+			continue
+		}
+		p := e.priority()
+		req := &request.Request{
+			Url:      link,
+			Rule:     rule,
+			Priority: priority + int(p*scale+0.5),
+			Temp:     request.Temp{SITEMAP_PRIORITY: p},
+		}
+		if t, ok := e.lastmod(); ok {
+			req.Temp[SITEMAP_LASTMOD] = t
+			req.Reloadable = sm.Recrawl > 0 && time.Since(t) <= sm.Recrawl
+		}
+		ctx.AddQueue(req)
+	}
+}
+
+// sitemapBody 返回解压后的正文，gzip按内容判断而非扩展名；
+// 正文已由GetText()等转码为UTF-8时decoded为true
+func sitemapBody(ctx *Context) (body []byte, decoded bool, err error) {
+	if ctx.text != nil {
+		body, decoded = ctx.text, true
+	} else {
+		body, err = ioutil.ReadAll(ctx.Response.Body)
+		ctx.Response.Body.Close()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if len(body) > 1 && body[0] == 0x1f && body[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, false, err
+		}
+		defer r.Close()
+		body, err = ioutil.ReadAll(r)
+		return body, false, err
+	}
+	return body, decoded, nil
+}
+
+// decodeSitemap 解析XML格式的urlset与sitemapindex，以及每行一个链接的文本格式；
+// decoded为true时正文已是UTF-8，忽略XML声明中的encoding
+func decodeSitemap(body []byte, decoded bool) (*sitemapDoc, error) {
+	doc := &sitemapDoc{}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if len(trimmed) > 0 && trimmed[0] != '<' {
+		for _, line := range strings.Split(string(trimmed), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				doc.URLs = append(doc.URLs, sitemapEntry{Loc: line})
+			}
+		}
+		return doc, nil
+	}
+	dec := xml.NewDecoder(bytes.NewReader(trimmed))
+	dec.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		if decoded {
+			return input, nil
+		}
+		b, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		b, err = DecodeBody(b, label)
+		return bytes.NewReader(b), err
+	}
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (self sitemapEntry) resolve(base *url.URL) string {
+	loc := strings.TrimSpace(self.Loc)
+	if loc == "" || base == nil {
+		return ""
+	}
+	u, err := base.Parse(loc)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func (self sitemapEntry) lastmod() (time.Time, bool) {
+	s := strings.TrimSpace(self.Lastmod)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range lastmodLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (self sitemapEntry) priority() float64 {
+	p, err := strconv.ParseFloat(strings.TrimSpace(self.Priority), 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0.5
+	}
+	return p
+}
+
+// stale lastmod早于Since时为true，未声明lastmod的不过滤
+func (self sitemapEntry) stale(sm *Sitemap) bool {
+	if sm.Since.IsZero() {
+		return false
+	}
+	t, ok := self.lastmod()
+	return ok && t.Before(sm.Since)
+}
@@ -0,0 +1,128 @@
+package spider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+	"time"
+
+	"go-spider/downloader/request"
+)
+
+func TestDecodeSitemap(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://example.com/a</loc><lastmod>2020-01-02</lastmod><priority>0.8</priority></url>
+  <url><loc>http://example.com/b</loc></url>
+</urlset>`))
+	w.Close()
+
+	ctx := &Context{text: buf.Bytes()}
+	body, decoded, err := sitemapBody(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded {
+		t.Error("gzip body reported as decoded")
+	}
+	doc, err := decodeSitemap(body, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.URLs) != 2 || doc.URLs[0].Loc != "http://example.com/a" {
+		t.Fatalf("unexpected urls %+v", doc.URLs)
+	}
+	if p := doc.URLs[0].priority(); p != 0.8 {
+		t.Errorf("priority = %v", p)
+	}
+	if p := doc.URLs[1].priority(); p != 0.5 {
+		t.Errorf("default priority = %v", p)
+	}
+	sm := &Sitemap{Since: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if !doc.URLs[0].stale(sm) || doc.URLs[1].stale(sm) {
+		t.Error("only entries with an old lastmod should be stale")
+	}
+
+	doc, err = decodeSitemap([]byte(`<sitemapindex><sitemap><loc>http://example.com/s1.xml.gz</loc></sitemap></sitemapindex>`), false)
+	if err != nil || len(doc.Sitemaps) != 1 {
+		t.Fatalf("sitemap index: %+v, %v", doc, err)
+	}
+}
+
+func TestSitemapRoute(t *testing.T) {
+	sm := &Sitemap{
+		Routes: []*SitemapRoute{{Pattern: `/news/`, Rule: "news", Priority: 100}},
+		Rule:   "page",
+	}
+	if rule, p := sm.route("http://example.com/news/1"); rule != "news" || p != 100 {
+		t.Errorf("got %s %d", rule, p)
+	}
+	if rule, _ := sm.route("http://example.com/about"); rule != "page" {
+		t.Errorf("got %s", rule)
+	}
+}
+
+func TestPrepareSitemapError(t *testing.T) {
+	for _, sm := range []*Sitemap{
+		{Routes: []*SitemapRoute{{Pattern: `/news/(`, Rule: "page"}}},
+		{Routes: []*SitemapRoute{{Pattern: `/news/`, Rule: "news"}}},
+		{Rule: "news"},
+	} {
+		sp := newTestSpider(map[string]*Rule{"page": {}})
+		sp.Sitemap = sm
+		if err := sp.prepare(); err == nil {
+			t.Errorf("%+v: want error", sm)
+		}
+	}
+	sp := newTestSpider(map[string]*Rule{"page": {}})
+	sp.Sitemap = &Sitemap{Routes: []*SitemapRoute{{Pattern: `/news/`, Rule: "page"}}, Rule: "page"}
+	if err := sp.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sp.RuleTree.Trunk[SITEMAP_RULE]; !ok {
+		t.Error("sitemap rule not added")
+	}
+}
+
+func TestDecodeSitemapEncoding(t *testing.T) {
+	const decl = `<?xml version="1.0" encoding="GBK"?>`
+	// 已转码的正文不按声明再次转码
+	doc, err := decodeSitemap([]byte(decl+`<urlset><url><loc>http://example.com/中文</loc></url></urlset>`), true)
+	if err != nil || len(doc.URLs) != 1 || doc.URLs[0].Loc != "http://example.com/中文" {
+		t.Errorf("decoded body: %+v, %v", doc, err)
+	}
+	// 原始正文按声明转码
+	doc, err = decodeSitemap([]byte(decl+"<urlset><url><loc>http://example.com/\xd6\xd0</loc></url></urlset>"), false)
+	if err != nil || len(doc.URLs) != 1 || doc.URLs[0].Loc != "http://example.com/中" {
+		t.Errorf("raw body: %+v, %v", doc, err)
+	}
+}
+
+func TestRobotsFailed(t *testing.T) {
+	sp := newTestSpider(nil)
+	sp.Sitemap = &Sitemap{}
+	if err := sp.prepareSitemap(); err != nil {
+		t.Fatal(err)
+	}
+	var reqs []*request.Request
+	sp.CatchRequests(func(req *request.Request) { reqs = append(reqs, req) })
+
+	robots := &request.Request{Url: "http://example.com/robots.txt", Rule: ROBOTS_RULE}
+	robots.Prepare()
+	sp.RequestFailed(robots, errors.New("404 Not Found"))
+	// 失败请求重试时不重复加入
+	sp.RequestFailed(robots, errors.New("404 Not Found"))
+	if len(reqs) != 1 || reqs[0].GetUrl() != "http://example.com/sitemap.xml" || reqs[0].GetRuleName() != SITEMAP_RULE {
+		t.Fatalf("got %v", reqs)
+	}
+
+	page := &request.Request{Url: "http://example.com/a", Rule: "page"}
+	page.Prepare()
+	sp.RequestFailed(page, errors.New("timeout"))
+	if len(reqs) != 1 {
+		t.Errorf("failed page request seeded a sitemap")
+	}
+}
@@ -2,6 +2,7 @@ package spider
 
 import (
 	"fmt"
+	"sync"
 	"go-spider/common/pinyin"
 )
 
@@ -10,6 +11,7 @@ type SpiderSpecies struct {
 	list   []*Spider
 	hash   map[string]*Spider
 	sorted bool
+	sync.RWMutex
 }
 
 
@@ -20,6 +22,8 @@ var Species = &SpiderSpecies{
 
 
 func (self *SpiderSpecies) Add(sp *Spider) *Spider {
+	self.Lock()
+	defer self.Unlock()
 	name := sp.Name
 	for i := 2; true; i++ {
 		if _, ok := self.hash[name]; !ok {
@@ -31,10 +35,50 @@ func (self *SpiderSpecies) Add(sp *Spider) *Spider {
 	}
 	sp.Name = name
 	self.list = append(self.list, sp)
+	self.sorted = false
 	return sp
 }
 
+// Replace 以sp替换同名蜘蛛，不存在时直接添加；已在运行的任务持有的是副本，不受影响
+func (self *SpiderSpecies) Replace(sp *Spider) *Spider {
+	self.Lock()
+	defer self.Unlock()
+	if old, ok := self.hash[sp.Name]; ok {
+		for i, s := range self.list {
+			if s == old {
+				self.list[i] = sp
+				break
+			}
+		}
+	} else {
+		self.list = append(self.list, sp)
+		self.sorted = false
+	}
+	self.hash[sp.Name] = sp
+	return sp
+}
+
+// Remove 注销指定名称的蜘蛛
+func (self *SpiderSpecies) Remove(name string) bool {
+	self.Lock()
+	defer self.Unlock()
+	old, ok := self.hash[name]
+	if !ok {
+		return false
+	}
+	delete(self.hash, name)
+	for i, s := range self.list {
+		if s == old {
+			self.list = append(self.list[:i], self.list[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
 func (self *SpiderSpecies) Get() []*Spider {
+	self.Lock()
+	defer self.Unlock()
 	if !self.sorted {
 		l := len(self.list)
 		initials := make([]string, l)
@@ -49,9 +93,13 @@ func (self *SpiderSpecies) Get() []*Spider {
 		}
 		self.sorted = true
 	}
-	return self.list
+	list := make([]*Spider, len(self.list))
+	copy(list, self.list)
+	return list
 }
 
 func (self *SpiderSpecies) GetByName(name string) *Spider {
+	self.RLock()
+	defer self.RUnlock()
 	return self.hash[name]
 }
\ No newline at end of file
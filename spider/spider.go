@@ -1,6 +1,8 @@
 package spider
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"math"
 	"sync"
 	"time"
@@ -26,13 +28,30 @@ type (
 		Limit           int64                                                      
 		Keyin           string                                                     
 		EnableCookie    bool                                                       
+		Profile         string                                                     
+		StickyProxy     bool                                                       // 开启Cookie时，整个会话固定使用同一代理IP
 		NotDefaultField bool                                                       
 		Namespace       func(self *Spider) string                                  
 		SubNamespace    func(self *Spider, dataCell map[string]interface{}) string 
+		Params          []*Param                                                   // 类型化参数声明，由SetParams赋值
 		RuleTree        *RuleTree                                                  
+		// OnStart 在Root之前执行，返回错误时不再执行Root与Sitemap播种，可用于准备外部资源
+		OnStart func(ctx *Context) error
+		// OnFinish 在队列处理完毕后执行，可用于释放外部资源与发送汇总通知
+		OnFinish func(self *Spider, stat SpiderStat)
+		// OnItem 在每条数据交给Collector之前执行，返回nil时丢弃，可修改后返回；不作用于未通过校验的数据
+		OnItem func(ctx *Context, ruleName string, item map[string]interface{}) map[string]interface{}
+		// OnError 在每次请求失败（下载失败或解析时panic）后执行
+		OnError func(self *Spider, req *request.Request, err error)
+		Sitemap         *Sitemap                                                   // 以sitemap播种，可不定义Root
 		id        int               
 		subName   string            
 		reqMatrix *scheduler.Matrix 
+		catcher   func(*request.Request)
+		params    map[string]interface{}
+		stat      spiderStat
+		feedsIn   []*feed    // 接收上游取值的通道
+		feedsOut  []*feedOut // 向下游传递取值的声明
 		timer     *Timer            
 		status    int               
 		lock      sync.RWMutex
@@ -46,15 +65,30 @@ type (
 		ItemFields []string                                           
 		ParseFunc  func(*Context)                                     
 		AidFunc    func(*Context, map[string]interface{}) interface{} 
+		Schema     []*SchemaField                                     // 类型化字段声明，Output时转换并校验
+		Processors map[string][]Processor                             // 字段处理链，键为字段名或ALL_FIELDS，先于Schema执行
+		items      int64                                              // 本次运行输出的数据条数
 	}
 )
 
 
 func (self Spider) Register() *Spider {
 	self.status = status.STOPPED
+	if err := self.prepare(); err != nil {
+		logs.Log.Error(" *     蜘蛛 %s 注册失败: %v\n", self.GetName(), err)
+		return &self
+	}
 	return Species.Add(&self)
 }
 
+// prepare 补全由声明生成的内部规则，注册、复制与热更新时调用
+func (self *Spider) prepare() error {
+	if err := self.prepareSchemas(); err != nil {
+		return err
+	}
+	return self.prepareSitemap()
+}
+
 func (self *Spider) GetItemFields(rule *Rule) []string {
 	return rule.ItemFields
 }
@@ -91,7 +125,7 @@ func (self *Spider) GetName() string {
 
 func (self *Spider) GetSubName() string {
 	self.once.Do(func() {
-		self.subName = self.GetKeyin()
+		self.subName = self.GetKeyin() + self.ParamsString()
 		self.subName = util.MakeHash(self.subName)
 	})
 	return self.subName
@@ -142,6 +176,18 @@ func (self *Spider) GetEnableCookie() bool {
 	return self.EnableCookie
 }
 
+func (self *Spider) GetProfile() string {
+	return self.Profile
+}
+
+// GetProxySession 返回请求默认的代理会话名，未开启StickyProxy或Cookie时为空
+func (self *Spider) GetProxySession() string {
+	if !self.StickyProxy || !self.EnableCookie {
+		return ""
+	}
+	return self.GetName() + ":" + self.GetSubName()
+}
+
 func (self *Spider) SetPausetime(pause int64, runtime ...bool) {
 	if self.Pausetime == 0 || len(runtime) > 0 && runtime[0] {
 		self.Pausetime = pause
@@ -179,10 +225,14 @@ func (self *Spider) Copy() *Spider {
 
 		ghost.RuleTree.Trunk[k].ParseFunc = v.ParseFunc
 		ghost.RuleTree.Trunk[k].AidFunc = v.AidFunc
+		ghost.RuleTree.Trunk[k].Schema = v.Schema
+		ghost.RuleTree.Trunk[k].Processors = v.Processors
 	}
 	ghost.Description = self.Description
 	ghost.Pausetime = self.Pausetime
 	ghost.EnableCookie = self.EnableCookie
+	ghost.Profile = self.Profile
+	ghost.StickyProxy = self.StickyProxy
 	ghost.Limit = self.Limit
 	ghost.Keyin = self.Keyin
 	ghost.NotDefaultField = self.NotDefaultField
@@ -190,6 +240,20 @@ func (self *Spider) Copy() *Spider {
 	ghost.SubNamespace = self.SubNamespace
 	ghost.timer = self.timer
 	ghost.status = self.status
+	ghost.Sitemap = self.Sitemap
+	ghost.Params = self.Params
+	ghost.OnStart = self.OnStart
+	ghost.OnFinish = self.OnFinish
+	ghost.OnItem = self.OnItem
+	ghost.OnError = self.OnError
+	if self.params != nil {
+		ghost.params = make(map[string]interface{}, len(self.params))
+		for k, v := range self.params {
+			ghost.params[k] = v
+		}
+	}
+	// 已注册的蜘蛛通过了prepare，副本不会出错
+	ghost.prepare()
 	return ghost
 }
 
@@ -207,10 +271,41 @@ func (self *Spider) DoHistory(req *request.Request, ok bool) bool {
 	return self.reqMatrix.DoHistory(req, ok)
 }
 
+// MarkSeen 将key记入抓取历史，可跨批次去重，此前已记录时返回false；未初始化调度（如测试与预览）时总返回true
+func (self *Spider) MarkSeen(key string) bool {
+	if self.reqMatrix == nil {
+		return true
+	}
+	return self.reqMatrix.MarkSuccess(self.seenUnique(key))
+}
+
+// Seen 返回key是否已由MarkSeen记录；未初始化调度时总返回false
+func (self *Spider) Seen(key string) bool {
+	if self.reqMatrix == nil {
+		return false
+	}
+	return self.reqMatrix.HasSuccess(self.seenUnique(key))
+}
+
+func (self *Spider) seenUnique(key string) string {
+	block := md5.Sum([]byte(self.GetName() + "\x00" + key))
+	return hex.EncodeToString(block[:])
+}
+
 func (self *Spider) RequestPush(req *request.Request) {
+	if self.catcher != nil {
+		self.catcher(req)
+		return
+	}
 	self.reqMatrix.Push(req)
 }
 
+// CatchRequests 使新入队的请求交由f处理而不进入调度器，用于测试与预览
+func (self *Spider) CatchRequests(f func(*request.Request)) *Spider {
+	self.catcher = f
+	return self
+}
+
 func (self *Spider) RequestPull() *request.Request {
 	return self.reqMatrix.Pull()
 }
@@ -244,7 +339,17 @@ func (self *Spider) Start() {
 		self.status = status.RUN
 		self.lock.Unlock()
 	}()
-	self.RuleTree.Root(GetContext(self, nil))
+	ctx := GetContext(self, nil)
+	if !self.onStart(ctx) {
+		return
+	}
+	self.consumeFeeds()
+	if self.RuleTree.Root != nil && !self.keyinChained() {
+		self.RuleTree.Root(ctx)
+	}
+	if self.Sitemap != nil {
+		ctx.AddSitemap(self.Sitemap.Urls...)
+	}
 }
 
 func (self *Spider) Stop() {
@@ -264,7 +369,7 @@ func (self *Spider) Stop() {
 func (self *Spider) CanStop() bool {
 	self.lock.RLock()
 	defer self.lock.RUnlock()
-	return self.status != status.STOPPED && self.reqMatrix.CanStop()
+	return self.status != status.STOPPED && self.reqMatrix.CanStop() && !self.chainsOpen()
 }
 
 func (self *Spider) IsStopping() bool {
@@ -287,8 +392,11 @@ func (self *Spider) Defer() {
 	}
 	
 	self.reqMatrix.Wait()
+	self.reqMatrix.ReleaseSessions()
+	self.closeFeeds()
 	
 	self.reqMatrix.TryFlushFailure()
+	self.onFinish()
 }
 
 func (self *Spider) OutDefaultField() bool {
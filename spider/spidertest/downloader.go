@@ -0,0 +1,119 @@
+package spidertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"go-spider/downloader/request"
+	"go-spider/downloader/surfer"
+	"go-spider/spider"
+)
+
+// FixtureFile 目录模式下的默认映射文件，内容为 {"url": "相对路径"}
+const FixtureFile = "fixtures.json"
+
+type (
+	dirDownloader struct {
+		dir     string
+		mapping map[string]string
+	}
+	serverDownloader struct {
+		base *url.URL
+		surf surfer.Surfer
+	}
+)
+
+// Dir 返回从本地目录读取响应的下载器，mapping为nil时读取dir下的fixtures.json
+func Dir(dir string, mapping map[string]string) (Downloader, error) {
+	if mapping == nil {
+		b, err := ioutil.ReadFile(filepath.Join(dir, FixtureFile))
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &mapping); err != nil {
+			return nil, fmt.Errorf("%s: %v", FixtureFile, err)
+		}
+	}
+	return &dirDownloader{dir: dir, mapping: mapping}, nil
+}
+
+// Server 返回将所有请求转发至srv的下载器，仅替换协议与主机，路径与参数保持不变
+func Server(srv *httptest.Server) Downloader {
+	base, _ := url.Parse(srv.URL)
+	return &serverDownloader{base: base, surf: surfer.New()}
+}
+
+func (self *dirDownloader) Download(sp *spider.Spider, req *request.Request) *spider.Context {
+	ctx := spider.GetContext(sp, req)
+	name, ok := self.mapping[req.GetUrl()]
+	if !ok {
+		ctx.SetResponse(fakeResponse(req, http.StatusNotFound, "", nil))
+		ctx.SetError(fmt.Errorf("no fixture for %s", req.GetUrl()))
+		return ctx
+	}
+	b, err := ioutil.ReadFile(filepath.Join(self.dir, name))
+	if err != nil {
+		ctx.SetResponse(fakeResponse(req, http.StatusNotFound, "", nil))
+		ctx.SetError(err)
+		return ctx
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
+	}
+	return ctx.SetResponse(fakeResponse(req, http.StatusOK, contentType, b))
+}
+
+func (self *serverDownloader) Download(sp *spider.Spider, req *request.Request) *spider.Context {
+	ctx := spider.GetContext(sp, req)
+	u, err := url.Parse(req.GetUrl())
+	if err != nil {
+		ctx.SetError(err)
+		return ctx
+	}
+	target := *u
+	target.Scheme, target.Host = self.base.Scheme, self.base.Host
+
+	r := req.Copy()
+	r.SetUrl(target.String())
+	r.TryTimes = 1
+	r.RetryPause = time.Millisecond
+	resp, err := self.surf.Download(r)
+	if resp != nil && resp.Request != nil {
+		resp.Request.URL = u
+		resp.Request.Host = u.Host
+	}
+	if err == nil && resp.StatusCode >= 400 {
+		err = fmt.Errorf("响应状态 %s", resp.Status)
+	}
+	ctx.SetResponse(resp).SetError(err)
+	return ctx
+}
+
+func fakeResponse(req *request.Request, code int, contentType string, body []byte) *http.Response {
+	u, _ := url.Parse(req.GetUrl())
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		Request: &http.Request{
+			Method: req.GetMethod(),
+			URL:    u,
+			Host:   u.Host,
+			Header: req.GetHeader(),
+		},
+	}
+}
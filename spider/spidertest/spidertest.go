@@ -0,0 +1,202 @@
+// Package spidertest 在不访问真实站点的情况下端到端运行已注册的蜘蛛，
+// 收集其输出的数据、文件与新入队的请求，并提供断言方法。
+package spidertest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"go-spider/downloader/request"
+	"go-spider/pipeline/collector/data"
+	"go-spider/spider"
+)
+
+type (
+	Downloader interface {
+		Download(*spider.Spider, *request.Request) *spider.Context
+	}
+
+	Harness struct {
+		Spider      *spider.Spider
+		Downloader  Downloader
+		MaxRequests int                         // 最多下载的请求数，0为不限
+		Follow      func(*request.Request) bool // 返回false的请求仅记录不下载，nil为全部下载
+		Items       []data.DataCell
+		Files       []data.FileCell
+		Requests    []*request.Request // 全部入队的请求
+		Failures    []Failure
+		queue       []*request.Request
+		seen        map[string]bool
+		lock        sync.Mutex
+	}
+
+	Failure struct {
+		Request *request.Request
+		Err     error
+	}
+)
+
+// New 基于sp的副本创建测试工具，不会影响已注册的蜘蛛
+func New(sp *spider.Spider, dl Downloader) *Harness {
+	h := &Harness{
+		Spider:     sp.Copy(),
+		Downloader: dl,
+		seen:       make(map[string]bool),
+	}
+	h.Spider.CatchRequests(h.push)
+	return h
+}
+
+// NewByName 按名称查找已注册的蜘蛛
+func NewByName(name string, dl Downloader) (*Harness, error) {
+	sp := spider.Species.GetByName(name)
+	if sp == nil {
+		return nil, fmt.Errorf("spider %q is not registered", name)
+	}
+	return New(sp, dl), nil
+}
+
+func (self *Harness) push(req *request.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.Requests = append(self.Requests, req)
+	if !req.IsReloadable() {
+		if self.seen[req.Unique()] {
+			return
+		}
+		self.seen[req.Unique()] = true
+	}
+	if self.Follow != nil && !self.Follow(req) {
+		return
+	}
+	self.queue = append(self.queue, req)
+}
+
+func (self *Harness) pull() *request.Request {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.queue) == 0 {
+		return nil
+	}
+	req := self.queue[0]
+	self.queue = self.queue[1:]
+	return req
+}
+
+// Run 执行根规则，并依次下载、解析队列中的请求直至队列为空或达到MaxRequests
+func (self *Harness) Run() *Harness {
+	self.Spider.Start()
+	for n := 0; self.MaxRequests <= 0 || n < self.MaxRequests; n++ {
+		req := self.pull()
+		if req == nil {
+			break
+		}
+		self.Process(req)
+	}
+	return self
+}
+
+// Process 下载并解析单个请求
+func (self *Harness) Process(req *request.Request) {
+	ctx := self.Downloader.Download(self.Spider, req)
+	defer func() {
+		if p := recover(); p != nil {
+			self.Failures = append(self.Failures, Failure{req, fmt.Errorf("panic: %v", p)})
+		}
+		spider.PutContext(ctx)
+	}()
+	if err := ctx.GetError(); err != nil {
+		self.Failures = append(self.Failures, Failure{req, err})
+		return
+	}
+	ctx.Parse(req.GetRuleName())
+	self.Files = append(self.Files, ctx.PullFiles()...)
+	self.Items = append(self.Items, ctx.PullItems()...)
+}
+
+// ItemsOf 返回指定规则输出的数据
+func (self *Harness) ItemsOf(ruleName string) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, cell := range self.Items {
+		if cell["RuleName"] == ruleName {
+			items = append(items, cell["Data"].(map[string]interface{}))
+		}
+	}
+	return items
+}
+
+// Queued 返回指定规则（为空时不限）入队的全部链接
+func (self *Harness) Queued(ruleName string) []string {
+	var urls []string
+	for _, req := range self.Requests {
+		if ruleName == "" || req.GetRuleName() == ruleName {
+			urls = append(urls, req.GetUrl())
+		}
+	}
+	return urls
+}
+
+func (self *Harness) AssertNoFailures(t testing.TB) {
+	t.Helper()
+	for _, f := range self.Failures {
+		t.Errorf("request %s [%s] failed: %v", f.Request.GetUrl(), f.Request.GetRuleName(), f.Err)
+	}
+}
+
+func (self *Harness) AssertItemCount(t testing.TB, ruleName string, want int) {
+	t.Helper()
+	if got := len(self.ItemsOf(ruleName)); got != want {
+		t.Errorf("rule %s: got %d items, want %d", ruleName, got, want)
+	}
+}
+
+// AssertField 断言指定规则第index条数据的字段值
+func (self *Harness) AssertField(t testing.TB, ruleName string, index int, field string, want interface{}) {
+	t.Helper()
+	items := self.ItemsOf(ruleName)
+	if index < 0 || index >= len(items) {
+		t.Errorf("rule %s: item %d out of range (%d items)", ruleName, index, len(items))
+		return
+	}
+	if got := items[index][field]; !reflect.DeepEqual(got, want) {
+		t.Errorf("rule %s item %d field %s: got %#v, want %#v", ruleName, index, field, got, want)
+	}
+}
+
+// AssertHasItem 断言指定规则存在一条数据，其字段值包含fields
+func (self *Harness) AssertHasItem(t testing.TB, ruleName string, fields map[string]interface{}) {
+	t.Helper()
+	for _, item := range self.ItemsOf(ruleName) {
+		match := true
+		for k, v := range fields {
+			if !reflect.DeepEqual(item[k], v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return
+		}
+	}
+	t.Errorf("rule %s: no item matches %#v", ruleName, fields)
+}
+
+// AssertQueued 断言某链接已入队，可选地限定其规则名
+func (self *Harness) AssertQueued(t testing.TB, url string, ruleName ...string) {
+	t.Helper()
+	for _, req := range self.Requests {
+		if req.GetUrl() != url {
+			continue
+		}
+		if len(ruleName) == 0 || req.GetRuleName() == ruleName[0] {
+			return
+		}
+	}
+	if len(ruleName) > 0 {
+		t.Errorf("request %s [%s] was not queued", url, ruleName[0])
+	} else {
+		t.Errorf("request %s was not queued", url)
+	}
+}
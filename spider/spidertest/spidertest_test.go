@@ -0,0 +1,87 @@
+package spidertest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"go-spider/common/goquery"
+	"go-spider/downloader/request"
+	"go-spider/spider"
+)
+
+var demo = &spider.Spider{
+	Name: "spidertest-demo",
+	RuleTree: &spider.RuleTree{
+		Root: func(ctx *spider.Context) {
+			ctx.AddQueue(&request.Request{Url: "http://example.com/list", Rule: "list"})
+		},
+		Trunk: map[string]*spider.Rule{
+			"list": {
+				ParseFunc: func(ctx *spider.Context) {
+					ctx.GetDom().Find("a").Each(func(i int, s *goquery.Selection) {
+						href, _ := s.Attr("href")
+						ctx.AddQueue(&request.Request{Url: "http://example.com" + href, Rule: "detail"})
+					})
+				},
+			},
+			"detail": {
+				ItemFields: []string{"title"},
+				ParseFunc: func(ctx *spider.Context) {
+					ctx.Output(map[int]interface{}{0: ctx.GetDom().Find("h1").Text()})
+				},
+			},
+		},
+	},
+}
+
+const (
+	listPage = `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/a">a</a></body></html>`
+	pageA    = `<html><body><h1>Alpha</h1></body></html>`
+	pageB    = `<html><body><h1>Beta</h1></body></html>`
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{"list.html": listPage, "a.html": pageA, "b.html": pageB} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dl, err := Dir(dir, map[string]string{
+		"http://example.com/list": "list.html",
+		"http://example.com/a":    "a.html",
+		"http://example.com/b":    "b.html",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(demo, dl).Run()
+	h.AssertNoFailures(t)
+	h.AssertQueued(t, "http://example.com/a", "detail")
+	h.AssertItemCount(t, "detail", 2)
+	h.AssertHasItem(t, "detail", map[string]interface{}{"title": "Beta"})
+}
+
+func TestServer(t *testing.T) {
+	pages := map[string]string{"/list": listPage, "/a": pageA, "/b": pageB}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	h := New(demo, Server(srv))
+	h.Follow = func(req *request.Request) bool { return req.GetRuleName() != "detail" }
+	h.Run()
+	h.AssertNoFailures(t)
+	h.AssertQueued(t, "http://example.com/b", "detail")
+	h.AssertItemCount(t, "detail", 0)
+}
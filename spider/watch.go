@@ -0,0 +1,123 @@
+package spider
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go-spider/logs"
+	"go-spider/runtime/status"
+)
+
+// WatchInterval 动态规则目录的检查间隔
+var WatchInterval = 2 * time.Second
+
+type (
+	// spiderWatcher 记录每个动态规则文件对应的蜘蛛，轮询目录并热更新Species
+	spiderWatcher struct {
+		files map[string]*watchedFile
+		once  sync.Once
+		sync.Mutex
+	}
+	watchedFile struct {
+		modTime time.Time
+		size    int64
+		name    string // 当前注册的蜘蛛名，为空表示尚未成功加载
+	}
+)
+
+var dynamicSpiders = &spiderWatcher{files: map[string]*watchedFile{}}
+
+// StartWatch 开始监视动态规则目录：文件变更时重新解析并原子替换同名蜘蛛，
+// 文件删除时注销其蜘蛛；解析失败时记录日志并保留旧版本。重复调用无效。
+func StartWatch() {
+	dynamicSpiders.once.Do(func() {
+		go func() {
+			for range time.Tick(WatchInterval) {
+				dynamicSpiders.scan()
+			}
+		}()
+	})
+}
+
+// loaded 记录初始加载的文件
+func (self *spiderWatcher) loaded(file, name string) {
+	self.Lock()
+	defer self.Unlock()
+	f := &watchedFile{name: name}
+	if info, err := os.Stat(file); err == nil {
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	self.files[file] = f
+}
+
+func (self *spiderWatcher) scan() {
+	self.scanFiles(spiderFiles())
+}
+
+// scanFiles 先注销已删除文件的蜘蛛，再加载新增与变更的文件，使改名的文件沿用原蜘蛛名
+func (self *spiderWatcher) scanFiles(files []string) {
+	self.Lock()
+	defer self.Unlock()
+
+	current := map[string]bool{}
+	for _, file := range files {
+		current[file] = true
+	}
+	for file, f := range self.files {
+		if current[file] {
+			continue
+		}
+		if f.name != "" && Species.Remove(f.name) {
+			logs.Log.Informational(" *     动态规则 [%s] 已删除，注销蜘蛛 %s\n", file, f.name)
+		}
+		delete(self.files, file)
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		f, ok := self.files[file]
+		if ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			continue
+		}
+		if !ok {
+			f = &watchedFile{}
+			self.files[file] = f
+		}
+		f.modTime, f.size = info.ModTime(), info.Size()
+		self.reload(file, f)
+	}
+}
+
+func (self *spiderWatcher) reload(file string, f *watchedFile) {
+	m, err := ParseSpiderFile(file)
+	if err != nil {
+		logs.Log.Error(" *     动态规则热更新失败，保留原版本: %v\n", err)
+		return
+	}
+	sp, err := m.Spider()
+	if err != nil {
+		logs.Log.Error(" *     动态规则热更新失败，保留原版本 [%s]: %v\n", file, err)
+		return
+	}
+	sp.status = status.STOPPED
+	if err := sp.prepare(); err != nil {
+		logs.Log.Error(" *     动态规则热更新失败，保留原版本 [%s]: %v\n", file, err)
+		return
+	}
+	switch {
+	case f.name == sp.Name:
+		Species.Replace(sp)
+		logs.Log.Informational(" *     动态规则 [%s] 已更新蜘蛛 %s\n", file, sp.Name)
+	default:
+		if f.name != "" {
+			Species.Remove(f.name)
+		}
+		Species.Add(sp)
+		logs.Log.Informational(" *     动态规则 [%s] 已加载蜘蛛 %s\n", file, sp.Name)
+	}
+	f.name = sp.Name
+}
@@ -0,0 +1,74 @@
+package spider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const watchRule = `{"Name": "%s", "Rule": [{"name": "list", "Process": [{"field": "title", "chain": "trim"}]}]}`
+
+func TestSpiderWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spiders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w := &spiderWatcher{files: map[string]*watchedFile{}}
+	write := func(file, name string, mod time.Time) {
+		ioutil.WriteFile(file, []byte(fmt.Sprintf(watchRule, name)), 0644)
+		os.Chtimes(file, mod, mod)
+	}
+	now := time.Now()
+
+	a := filepath.Join(dir, "a.json")
+	write(a, "watch_a", now)
+	defer Species.Remove("watch_a")
+	w.scanFiles([]string{a})
+	sp := Species.GetByName("watch_a")
+	if sp == nil {
+		t.Fatal("new file not loaded")
+	}
+	// 热更新与Register一样补全内部规则
+	if _, ok := sp.GetRule("list" + REJECTS_SUFFIX); !ok {
+		t.Error("reloaded spider not prepared")
+	}
+
+	// 未变更的文件不重新加载
+	w.scanFiles([]string{a})
+	if Species.GetByName("watch_a") != sp {
+		t.Error("unchanged file reloaded")
+	}
+
+	write(a, "watch_a", now.Add(time.Minute))
+	w.scanFiles([]string{a})
+	if cur := Species.GetByName("watch_a"); cur == sp || cur == nil {
+		t.Error("modified file not reloaded")
+	}
+
+	// 改名后沿用原蜘蛛名，不产生watch_a(2)
+	b := filepath.Join(dir, "b.json")
+	os.Rename(a, b)
+	w.scanFiles([]string{b})
+	if Species.GetByName("watch_a") == nil || Species.GetByName("watch_a(2)") != nil {
+		t.Error("renamed file registered twice")
+	}
+
+	// 解析失败时保留原版本
+	old := Species.GetByName("watch_a")
+	ioutil.WriteFile(b, []byte("{"), 0644)
+	os.Chtimes(b, now.Add(2*time.Minute), now.Add(2*time.Minute))
+	w.scanFiles([]string{b})
+	if Species.GetByName("watch_a") != old {
+		t.Error("broken file replaced the spider")
+	}
+
+	os.Remove(b)
+	w.scanFiles(nil)
+	if Species.GetByName("watch_a") != nil {
+		t.Error("removed file still registered")
+	}
+}
@@ -0,0 +1,134 @@
+package spider
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+
+	"go-spider/logs"
+)
+
+var (
+	xpathCache = struct {
+		m map[string]*xpath.Expr
+		sync.RWMutex
+	}{m: map[string]*xpath.Expr{}}
+	// 正文已转码为UTF-8，去掉XML声明中的encoding以免被再次转码
+	xmlEncodingRegexp = regexp.MustCompile(`^(\s*<\?xml[^>]*?)\s+encoding\s*=\s*["'][^"']*["']`)
+)
+
+func compileXPath(expr string) (*xpath.Expr, error) {
+	xpathCache.RLock()
+	e, ok := xpathCache.m[expr]
+	xpathCache.RUnlock()
+	if ok {
+		return e, nil
+	}
+	e, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	xpathCache.Lock()
+	xpathCache.m[expr] = e
+	xpathCache.Unlock()
+	return e, nil
+}
+
+// XPath 返回第一个匹配节点的文本（属性节点为属性值），表达式结果为数值、字符串或布尔值时返回其字符串形式；
+// HTML与XML响应均可使用，与GetDom()共用已转码的正文
+func (self *Context) XPath(expr string) string {
+	values := self.xpath(expr, true)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// XPathAll 返回全部匹配节点的文本
+func (self *Context) XPathAll(expr string) []string {
+	return self.xpath(expr, false)
+}
+
+func (self *Context) xpath(expr string, first bool) []string {
+	e, err := compileXPath(expr)
+	if err != nil {
+		logs.Log.Error(" *     XPath [%v]: %v\n", expr, err)
+		return nil
+	}
+	var nav xpath.NodeNavigator
+	if self.isXML() {
+		doc := self.getXMLDoc()
+		if doc == nil {
+			return nil
+		}
+		nav = xmlquery.CreateXPathNavigator(doc)
+	} else {
+		nav = htmlquery.CreateXPathNavigator(self.htmlRoot())
+	}
+
+	switch v := e.Evaluate(nav).(type) {
+	case *xpath.NodeIterator:
+		var values []string
+		for v.MoveNext() {
+			values = append(values, strings.TrimSpace(v.Current().Value()))
+			if first {
+				break
+			}
+		}
+		return values
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	}
+	return nil
+}
+
+// htmlRoot 返回GetDom()缓存文档的根节点
+func (self *Context) htmlRoot() *html.Node {
+	return self.GetDom().Nodes[0]
+}
+
+// isXML 根据Content-Type判断，缺失时根据正文开头判断
+func (self *Context) isXML() bool {
+	if mediatype, _, err := mime.ParseMediaType(self.Response.Header.Get("Content-Type")); err == nil {
+		switch {
+		case strings.Contains(mediatype, "html"):
+			return false
+		case strings.HasSuffix(mediatype, "xml"):
+			return true
+		}
+	}
+	text := self.GetText()
+	if len(text) > sniffLen {
+		text = text[:sniffLen]
+	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	return strings.HasPrefix(text, "<?xml") && !strings.Contains(text, "<html")
+}
+
+func (self *Context) getXMLDoc() *xmlquery.Node {
+	if self.xmlDoc == nil {
+		if self.text == nil {
+			self.initText()
+		}
+		text := xmlEncodingRegexp.ReplaceAll(self.text, []byte("$1"))
+		doc, err := xmlquery.Parse(bytes.NewReader(text))
+		if err != nil {
+			logs.Log.Error(" *     XML [%v]: %v\n", self.GetUrl(), err)
+			return nil
+		}
+		self.xmlDoc = doc
+	}
+	return self.xmlDoc
+}
@@ -0,0 +1,65 @@
+package spider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestXPathHTML(t *testing.T) {
+	ctx := newTestContext(nil, "http://example.com/", "text/html; charset=utf-8",
+		`<html><body><ul><li><a href="/1">One</a></li><li><a href="/2"> Two </a></li></ul></body></html>`)
+	defer PutContext(ctx)
+
+	if got := ctx.XPath("//li/a"); got != "One" {
+		t.Errorf("XPath = %q", got)
+	}
+	if got := ctx.XPathAll("//li/a"); !reflect.DeepEqual(got, []string{"One", "Two"}) {
+		t.Errorf("XPathAll = %q", got)
+	}
+	if got := ctx.XPathAll("//a/@href"); !reflect.DeepEqual(got, []string{"/1", "/2"}) {
+		t.Errorf("attributes = %q", got)
+	}
+	if got := ctx.XPath("count(//li)"); got != "2" {
+		t.Errorf("count = %q", got)
+	}
+	if got := ctx.XPath("//li["); got != "" {
+		t.Errorf("bad expression = %q", got)
+	}
+}
+
+func TestXPathXML(t *testing.T) {
+	// 正文已按响应头转码为UTF-8，encoding声明不应导致再次转码
+	ctx := newTestContext(nil, "http://example.com/feed", "application/xml; charset=utf-8",
+		`<?xml version="1.0" encoding="gb2312"?><rss><item id="a"><title>标题</title></item><item id="b"><title>B</title></item></rss>`)
+	defer PutContext(ctx)
+
+	if got := ctx.XPathAll("//item/title"); !reflect.DeepEqual(got, []string{"标题", "B"}) {
+		t.Errorf("XPathAll = %q", got)
+	}
+	if got := ctx.XPath("//item[2]/@id"); got != "b" {
+		t.Errorf("attribute = %q", got)
+	}
+}
+
+func TestXPathResetText(t *testing.T) {
+	ctx := newTestContext(nil, "http://example.com/feed", "text/xml", `<a><b>old</b></a>`)
+	defer PutContext(ctx)
+
+	if got := ctx.XPath("//b"); got != "old" {
+		t.Fatalf("XPath = %q", got)
+	}
+	ctx.ResetText(`<a><b>new</b></a>`)
+	if got := ctx.XPath("//b"); got != "new" {
+		t.Errorf("after ResetText = %q", got)
+	}
+
+	html := newTestContext(nil, "http://example.com/", "text/html", `<p>old</p>`)
+	defer PutContext(html)
+	if got := html.XPath("//p"); got != "old" {
+		t.Fatalf("XPath = %q", got)
+	}
+	html.ResetText(`<p>new</p>`)
+	if got := html.XPath("//p"); got != "new" {
+		t.Errorf("after ResetText = %q", got)
+	}
+}